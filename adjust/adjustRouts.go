@@ -20,89 +20,333 @@ func getDistance(loc, loc2 Location) float64 {
 	return 2.0 * EarthRadius * math.Asin(math.Sqrt(x))
 }
 
+// segment describes the step between two consecutive points of a route.
+type segment struct {
+	distance float64
+	time     float64
+	// speed is only set when the segment is no gap and takes time
+	speed    float64
+	hasSpeed bool
+	// accel is the change of speed from the previous segment, only set when
+	// both segments have a speed
+	accel    float64
+	hasAccel bool
+}
+
+// AdjustedRoute filters rawRoute with DefaultOptions.
 func AdjustedRoute(rawRoute []Location) (route []Location, err error) {
-	buildGPSInfo := func(routeList []Location) []map[string]float64 {
-		var GPSInfoList []map[string]float64
-		for i := 0; i < len(routeList)-1; i++ {
-			GPSInfo := make(map[string]float64)
-			GPSInfo["distance"] = getDistance(routeList[i], routeList[i+1])
-			GPSInfo["time"] = float64(routeList[i+1].UTC - routeList[i].UTC)
-			GPSInfoList = append(GPSInfoList, GPSInfo)
+	return AdjustRoute(rawRoute, DefaultOptions())
+}
+
+// AdjustRoute removes the points of rawRoute that imply an implausible speed.
+// Locations carry no accuracy, so opts.MaxAccuracy and opts.PreferAccurate
+// only take effect with AdjustFixes.
+func AdjustRoute(rawRoute []Location, opts Options) (route []Location, err error) {
+	if err = opts.Validate(); err != nil {
+		return []Location{}, err
+	}
+	route, _, err = adjustRoute(rawRoute, nil, opts, nil)
+	return route, err
+}
+
+// AdjustRouteWithReport is like AdjustRoute but also explains the decision
+// taken for every point of rawRoute.
+func AdjustRouteWithReport(rawRoute []Location, opts Options) (route []Location, report *Report, err error) {
+	if err = opts.Validate(); err != nil {
+		return []Location{}, nil, err
+	}
+	report = newReport(len(rawRoute))
+	if route, _, err = adjustRoute(rawRoute, nil, opts, report); err != nil {
+		return []Location{}, nil, err
+	}
+	return route, report, nil
+}
+
+// AdjustFixes is like AdjustRoute but reads the horizontal accuracy of the
+// fixes for opts.MaxAccuracy and opts.PreferAccurate. The fixes it keeps
+// keep their metadata.
+func AdjustFixes(rawFixes []Fix, opts Options) ([]Fix, error) {
+	if err := opts.Validate(); err != nil {
+		return []Fix{}, err
+	}
+	return adjustFixes(rawFixes, opts, nil)
+}
+
+// AdjustFixesWithReport is like AdjustFixes but also explains the decision
+// taken for every fix of rawFixes.
+func AdjustFixesWithReport(rawFixes []Fix, opts Options) ([]Fix, *Report, error) {
+	if err := opts.Validate(); err != nil {
+		return []Fix{}, nil, err
+	}
+	report := newReport(len(rawFixes))
+	fixes, err := adjustFixes(rawFixes, opts, report)
+	if err != nil {
+		return []Fix{}, nil, err
+	}
+	return fixes, report, nil
+}
+
+func adjustFixes(rawFixes []Fix, opts Options, report *Report) ([]Fix, error) {
+	route, indices, err := adjustRoute(Locations(rawFixes), horizontalAccuracies(rawFixes), opts, report)
+	if err != nil {
+		return []Fix{}, err
+	}
+	if route == nil {
+		return nil, nil
+	}
+	fixes := make([]Fix, len(route))
+	for i, loc := range route {
+		fixes[i] = rawFixes[indices[i]]
+		fixes[i].Location = loc
+	}
+	return fixes, nil
+}
+
+// adjustRoute runs the filter passes over a copy of rawRoute and fills in
+// report unless it is nil. accuracies holds the horizontal accuracy of every
+// point, or is nil when none is known. Along with the kept points it returns
+// their positions in rawRoute. The buffers are allocated once and reused by
+// every pass.
+func adjustRoute(rawRoute []Location, accuracies []float64, opts Options, report *Report) ([]Location, []int, error) {
+	if !opts.DropInvalid {
+		if err := ValidateRoute(rawRoute); err != nil {
+			return []Location{}, nil, err
 		}
-		return GPSInfoList
 	}
 
 	getHashString := func(point Location) (string, error) {
 		lat := point.Lat
 		lng := point.Lng
-		hashString, err := mgeo.HashEncodeWithPrecision(lat, lng, 8)
+		hashString, err := mgeo.HashEncodeWithPrecision(lat, lng, opts.Precision)
 		return hashString, err
 	}
 
-	reconstructRoute := func(routeList []Location, suspiciousValues map[string]int) ([]Location, error) {
-		maxValue := 1
-		for _, value := range suspiciousValues {
-			if value > maxValue {
-				maxValue = value
+	// buildBuckets assigns each point of rawRoute to a suspicion bucket and
+	// returns the bucket of every point along with the number of buckets.
+	// Every point is its own bucket unless opts.ClusterByGeohash is set, in
+	// which case each point is encoded exactly once and invalid points that
+	// are going to be dropped get no bucket.
+	buildBuckets := func() ([]int, int, error) {
+		buckets := make([]int, len(rawRoute))
+		if !opts.ClusterByGeohash {
+			for i := range buckets {
+				buckets[i] = i
 			}
+			return buckets, len(rawRoute), nil
 		}
 
-		var newRouteList []Location
-		for _, point := range routeList {
+		ids := make(map[string]int)
+		for i, point := range rawRoute {
+			if opts.DropInvalid && ValidateLocation(point) != nil {
+				buckets[i] = -1
+				continue
+			}
 			hashString, err := getHashString(point)
 			if err != nil {
-				return newRouteList, err
+				return nil, 0, err
 			}
-			// if key hashString does not exists, suspiciousValues[hashString] return 0
-			if suspiciousValues[hashString] < maxValue {
-				newRouteList = append(newRouteList, point)
+			id, ok := ids[hashString]
+			if !ok {
+				id = len(ids)
+				ids[hashString] = id
 			}
+			buckets[i] = id
 		}
+		return buckets, len(ids), nil
+	}
 
-		if n := len(routeList); n > 2 {
-			var h1, h2 string
-			h1, _ = getHashString(routeList[0])
-			h2, _ = getHashString(routeList[1])
-			if suspiciousValues[h1] == suspiciousValues[h2] && suspiciousValues[h1] == maxValue {
-				tmpRouteList := append([]Location{}, routeList[1])
-				newRouteList = append(tmpRouteList, newRouteList...)
+	buckets, bucketN, err := buildBuckets()
+	if err != nil {
+		return []Location{}, nil, err
+	}
+
+	route := make([]Location, 0, len(rawRoute))
+	// indices maps the positions in route back to rawRoute
+	indices := make([]int, 0, len(rawRoute))
+	for i, point := range rawRoute {
+		if opts.DropInvalid && ValidateLocation(point) != nil {
+			if report != nil {
+				report.Points[i].Decision = DecisionDrop
+				report.Points[i].Rule = RuleInvalid
+			}
+			continue
+		}
+		if opts.MaxAccuracy > 0 && accuracies != nil && accuracies[i] > opts.MaxAccuracy {
+			if report != nil {
+				report.Points[i].Decision = DecisionDrop
+				report.Points[i].Rule = RuleAccuracy
 			}
+			continue
+		}
+		route = append(route, point)
+		indices = append(indices, i)
+	}
+	segments := make([]segment, 0, len(rawRoute))
+	suspiciousValues := make([]int, bucketN)
+	var rules []Rule
+	if report != nil {
+		rules = make([]Rule, bucketN)
+	}
 
-			if 1 != n-2 {
-				h1, _ = getHashString(routeList[n-2])
-				h2, _ = getHashString(routeList[n-1])
-				if suspiciousValues[h1] == suspiciousValues[h2] && suspiciousValues[h1] == maxValue {
-					newRouteList = append(newRouteList, routeList[n-2])
-				}
+	buildSegments := func() {
+		segments = segments[:0]
+		for i := 0; i < len(route)-1; i++ {
+			seg := segment{
+				distance: getDistance(route[i], route[i+1]),
+				time:     route[i+1].UTC - route[i].UTC,
+			}
+			if seg.time > 0 && !(opts.MaxGap > 0 && seg.time > opts.MaxGap) {
+				seg.speed = seg.distance / seg.time
+				seg.hasSpeed = true
+			}
+			if i > 0 && seg.hasSpeed && segments[i-1].hasSpeed {
+				prev := segments[i-1]
+				seg.accel = (seg.speed - prev.speed) / ((prev.time + seg.time) / 2.0)
+				seg.hasAccel = true
 			}
+			segments = append(segments, seg)
 		}
-		return newRouteList, nil
 	}
 
-	updateSuspiciousValues := func(point Location, suspiciousValues map[string]int) error {
-		hashString, err := getHashString(point)
-		if err != nil {
-			return err
+	// suspicion returns the suspicion count of the point at position i of route
+	suspicion := func(i int) int {
+		return suspiciousValues[buckets[indices[i]]]
+	}
+
+	raise := func(i int, rule Rule) {
+		b := buckets[indices[i]]
+		suspiciousValues[b]++
+		if rules != nil && rules[b] == RuleNone {
+			rules[b] = rule
 		}
-		suspiciousValues[hashString]++
-		return nil
 	}
 
-	upperSpeed := 20.0
-	thresholdN := 10
-	for i := 0; i < thresholdN; i++ {
-		GPSInfoList := buildGPSInfo(rawRoute)
-		suspiciousValues := make(map[string]int)
-		for j, GPSInfo := range GPSInfoList {
-			if 2.0*upperSpeed*GPSInfo["time"] < GPSInfo["distance"] {
-				updateSuspiciousValues(rawRoute[j], suspiciousValues)
-				updateSuspiciousValues(rawRoute[j+1], suspiciousValues)
+	// raisePair raises suspicion on both points of the segment starting at
+	// position i, or only on the less accurate one when opts.PreferAccurate
+	// is set and both accuracies are known and differ.
+	raisePair := func(i int, rule Rule) {
+		if opts.PreferAccurate && accuracies != nil {
+			a1, a2 := accuracies[indices[i]], accuracies[indices[i+1]]
+			if a1 > 0 && a2 > 0 && a1 != a2 {
+				if a1 > a2 {
+					raise(i, rule)
+				} else {
+					raise(i+1, rule)
+				}
+				return
+			}
+		}
+		raise(i, rule)
+		raise(i+1, rule)
+	}
+
+	for i := 0; opts.Iterations == 0 || i < opts.Iterations; i++ {
+		buildSegments()
+		for j := range route {
+			b := buckets[indices[j]]
+			suspiciousValues[b] = 0
+			if rules != nil {
+				rules[b] = RuleNone
+			}
+		}
+
+		for j, seg := range segments {
+			if report != nil {
+				report.Points[indices[j]].observeSegment(seg.distance, seg.time)
+				report.Points[indices[j+1]].observeSegment(seg.distance, seg.time)
+			}
+			if opts.MaxGap > 0 && seg.time > opts.MaxGap {
+				// across a gap only a jump the elapsed time cannot explain
+				// is suspicious
+				if opts.GapSpeed > 0 && opts.GapSpeed*seg.time < seg.distance {
+					raisePair(j, RuleGap)
+				}
+				continue
 			}
+			if opts.SpeedFactor*opts.MaxSpeed*seg.time < seg.distance {
+				raisePair(j, RuleSpeed)
+			}
+			if opts.MaxAcceleration > 0 && seg.hasAccel && math.Abs(seg.accel) > opts.MaxAcceleration {
+				raisePair(j, RuleAcceleration)
+			}
+			if opts.MaxJerk > 0 && seg.hasAccel && j > 0 && segments[j-1].hasAccel {
+				if jerk := (seg.accel - segments[j-1].accel) / segments[j-1].time; math.Abs(jerk) > opts.MaxJerk {
+					raisePair(j, RuleJerk)
+				}
+			}
+		}
+
+		if opts.Spike != nil {
+			for j := 1; j < len(segments); j++ {
+				prev, next := segments[j-1], segments[j]
+				if !prev.hasSpeed || !next.hasSpeed {
+					continue
+				}
+				if opts.Spike.isSpike(route[j-1], route[j], route[j+1], prev.distance, next.distance) {
+					raise(j, RuleSpike)
+				}
+			}
+		}
+
+		n := len(route)
+		maxValue := 1
+		for j := 0; j < n; j++ {
+			if value := suspicion(j); value > maxValue {
+				maxValue = value
+			}
+		}
+		if report != nil {
+			for j := 0; j < n; j++ {
+				point := &report.Points[indices[j]]
+				if value := suspicion(j); value > 0 {
+					point.Suspicion += value
+					point.Rule = rules[buckets[indices[j]]]
+				}
+			}
+			report.Iterations++
+		}
+
+		// When both points at an end of the route are dropped, the inner
+		// one of them is kept.
+		keepSecond, keepPenultimate := false, false
+		if n > 2 {
+			keepSecond = suspicion(0) == maxValue && suspicion(1) == maxValue
+			if 1 != n-2 {
+				keepPenultimate = suspicion(n-2) == maxValue && suspicion(n-1) == maxValue
+			}
+		}
+
+		kept := 0
+		for j := 0; j < n; j++ {
+			if suspicion(j) < maxValue || j == 1 && keepSecond || j == n-2 && keepPenultimate {
+				route[kept] = route[j]
+				indices[kept] = indices[j]
+				kept++
+			} else if report != nil {
+				point := &report.Points[indices[j]]
+				point.Decision = DecisionDrop
+				point.Iteration = i + 1
+			}
+		}
+		if kept == n {
+			// nothing was removed, further passes would see the same route
+			if report != nil {
+				report.Converged = true
+			}
+			break
+		}
+		route, indices = route[:kept], indices[:kept]
+	}
+	if len(route) == 0 {
+		return nil, nil, nil
+	}
+	if from := opts.Datum; opts.OutputDatum != "" {
+		if from == "" {
+			from = WGS84
 		}
-		rawRoute, err = reconstructRoute(rawRoute, suspiciousValues)
-		if err != nil {
-			return []Location{}, err
+		for i := range route {
+			route[i], _ = ConvertLocation(route[i], from, opts.OutputDatum)
 		}
 	}
-	return rawRoute, nil
+	return route, indices, nil
 }
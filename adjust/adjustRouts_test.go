@@ -0,0 +1,356 @@
+package adjust
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	mgeo "github.com/eleme/clair/matrix/geo"
+)
+
+// metres per degree of latitude
+const degree = EarthRadius * math.Pi / 180.0
+
+// straightRoute returns n fixes heading north at speed metres per second,
+// one every dt seconds.
+func straightRoute(n int, speed, dt float64) []Location {
+	route := make([]Location, n)
+	for i := range route {
+		route[i] = Location{
+			Lat: 31.2 + float64(i)*speed*dt/degree,
+			Lng: 121.4,
+			UTC: 1.5e9 + float64(i)*dt,
+		}
+	}
+	return route
+}
+
+// shift moves loc north and east by the given metres.
+func shift(loc Location, north, east float64) Location {
+	loc.Lat += north / degree
+	loc.Lng += east / (degree * math.Cos(loc.Lat*math.Pi/180.0))
+	return loc
+}
+
+// randomRoute returns a jittery walk of n fixes, about 15% of them outliers.
+func randomRoute(r *rand.Rand, n int) []Location {
+	var route []Location
+	lat, lng, t := 31.2, 121.4, 1.5e9
+	for i := 0; i < n; i++ {
+		lat += r.NormFloat64() * 0.0001
+		lng += r.NormFloat64() * 0.0001
+		t += float64(1 + r.Intn(5))
+		loc := Location{Lat: lat, Lng: lng, UTC: t}
+		if r.Float64() < 0.15 {
+			loc.Lat += r.NormFloat64() * 0.01
+			loc.Lng += r.NormFloat64() * 0.01
+		}
+		route = append(route, loc)
+	}
+	return route
+}
+
+// baselineAdjustedRoute is the filter as it was before suspicion moved to
+// point indices, kept to check that ClusterByGeohash still reproduces it.
+func baselineAdjustedRoute(rawRoute []Location) ([]Location, error) {
+	hash := func(point Location) string {
+		hashString, _ := mgeo.HashEncodeWithPrecision(point.Lat, point.Lng, 8)
+		return hashString
+	}
+	for i := 0; i < 10; i++ {
+		suspiciousValues := make(map[string]int)
+		for j := 0; j < len(rawRoute)-1; j++ {
+			distance := getDistance(rawRoute[j], rawRoute[j+1])
+			time := rawRoute[j+1].UTC - rawRoute[j].UTC
+			if 2.0*20.0*time < distance {
+				suspiciousValues[hash(rawRoute[j])]++
+				suspiciousValues[hash(rawRoute[j+1])]++
+			}
+		}
+		maxValue := 1
+		for _, value := range suspiciousValues {
+			if value > maxValue {
+				maxValue = value
+			}
+		}
+		var newRoute []Location
+		for _, point := range rawRoute {
+			if suspiciousValues[hash(point)] < maxValue {
+				newRoute = append(newRoute, point)
+			}
+		}
+		if n := len(rawRoute); n > 2 {
+			h1, h2 := hash(rawRoute[0]), hash(rawRoute[1])
+			if suspiciousValues[h1] == suspiciousValues[h2] && suspiciousValues[h1] == maxValue {
+				newRoute = append([]Location{rawRoute[1]}, newRoute...)
+			}
+			if 1 != n-2 {
+				h1, h2 = hash(rawRoute[n-2]), hash(rawRoute[n-1])
+				if suspiciousValues[h1] == suspiciousValues[h2] && suspiciousValues[h1] == maxValue {
+					newRoute = append(newRoute, rawRoute[n-2])
+				}
+			}
+		}
+		rawRoute = newRoute
+	}
+	return rawRoute, nil
+}
+
+func TestClusterByGeohashMatchesBaseline(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ClusterByGeohash = true
+	r := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 500; trial++ {
+		raw := randomRoute(r, r.Intn(60))
+		got, err := AdjustRoute(raw, opts)
+		if err != nil {
+			t.Fatalf("trial %d: %v", trial, err)
+		}
+		want, _ := baselineAdjustedRoute(append([]Location{}, raw...))
+		if len(got) != len(want) || len(got) > 0 && !reflect.DeepEqual(got, want) {
+			t.Fatalf("trial %d: got %d points %v, want %d points %v", trial, len(got), got, len(want), want)
+		}
+	}
+}
+
+func TestPrecisionOnlyForClusters(t *testing.T) {
+	raw := straightRoute(12, 5, 1)
+	raw[6] = shift(raw[6], 0, 1000)
+	route, err := AdjustRoute(raw, Options{MaxSpeed: 10, SpeedFactor: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(route) != len(raw)-1 {
+		t.Errorf("kept %d points, want %d", len(route), len(raw)-1)
+	}
+	_, err = AdjustRoute(raw, Options{MaxSpeed: 10, SpeedFactor: 2, ClusterByGeohash: true})
+	if oe, ok := err.(*OptionError); !ok || oe.Field != "Precision" {
+		t.Errorf("clustering without a precision: error %v, want an OptionError for Precision", err)
+	}
+}
+
+func TestRevisits(t *testing.T) {
+	// a rider waits at a restaurant, rides off north at 5 m/s and comes
+	// back an hour later, when one fix glitches to the far end of the ride
+	restaurant := Location{Lat: 31.2, Lng: 121.4, UTC: 1.5e9}
+	var raw []Location
+	for i := 0; i < 5; i++ {
+		loc := restaurant
+		loc.UTC += float64(i)
+		raw = append(raw, loc)
+	}
+	for _, loc := range straightRoute(20, 5, 1)[1:] {
+		loc.UTC += 5
+		raw = append(raw, loc)
+	}
+	far := raw[len(raw)-1]
+	for i := 0; i < 5; i++ {
+		loc := restaurant
+		loc.UTC += 3600 + float64(i)
+		raw = append(raw, loc)
+	}
+	glitch := len(raw) - 3
+	raw[glitch].Lat, raw[glitch].Lng = far.Lat, far.Lng
+
+	tests := []struct {
+		name    string
+		cluster bool
+		dropped []int
+	}{
+		// only the glitch goes
+		{"per index", false, []int{glitch}},
+		// the glitch shares its cell with the far end of the first ride and
+		// its neighbours share theirs with both visits to the restaurant,
+		// so all of those go but for the second and the penultimate point,
+		// which the rule for the ends of a route keeps
+		{"geohash", true, []int{0, 2, 3, 4, 5, 6, 7, 23, 24, 25, glitch, 28}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.ClusterByGeohash = tt.cluster
+		_, report, err := AdjustRouteWithReport(raw, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := report.Dropped(); !reflect.DeepEqual(got, tt.dropped) {
+			t.Errorf("%s: dropped %v, want %v", tt.name, got, tt.dropped)
+		}
+	}
+}
+
+func TestRuleAttribution(t *testing.T) {
+	// a fix 14 m ahead of where it should be
+	ahead := straightRoute(12, 5, 1)
+	ahead[6] = shift(ahead[6], 14, 0)
+
+	tests := []struct {
+		name    string
+		route   func() []Location
+		fixes   func([]Fix)
+		opts    func(*Options)
+		dropped []int
+		rule    Rule
+	}{
+		{
+			name: "speed",
+			route: func() []Location {
+				route := straightRoute(12, 5, 1)
+				route[6] = shift(route[6], 0, 1000)
+				return route
+			},
+			dropped: []int{6},
+			rule:    RuleSpeed,
+		},
+		{
+			name:    "acceleration",
+			route:   func() []Location { return ahead },
+			opts:    func(o *Options) { o.MaxAcceleration = 5 },
+			dropped: []int{6},
+			rule:    RuleAcceleration,
+		},
+		{
+			name:    "jerk",
+			route:   func() []Location { return ahead },
+			opts:    func(o *Options) { o.MaxJerk = 5 },
+			dropped: []int{6, 7},
+			rule:    RuleJerk,
+		},
+		{
+			name: "spike",
+			route: func() []Location {
+				route := straightRoute(12, 5, 10)
+				route[6] = shift(route[6], 0, 300)
+				return route
+			},
+			opts: func(o *Options) {
+				spike := DefaultSpikeOptions()
+				o.Spike = &spike
+			},
+			dropped: []int{6},
+			rule:    RuleSpike,
+		},
+		{
+			name: "gap",
+			route: func() []Location {
+				// two minutes in a tunnel, then a fix 5 km off
+				route := straightRoute(12, 5, 1)
+				for i := 6; i < len(route); i++ {
+					route[i] = shift(route[i], 300, 0)
+					route[i].UTC += 120
+				}
+				route[6] = shift(route[6], 0, 5000)
+				return route
+			},
+			opts:    func(o *Options) { o.MaxGap, o.GapSpeed = 60, 5 },
+			dropped: []int{6},
+			rule:    RuleGap,
+		},
+		{
+			name: "invalid",
+			route: func() []Location {
+				route := straightRoute(12, 5, 1)
+				route[6].Lat = math.NaN()
+				return route
+			},
+			opts:    func(o *Options) { o.DropInvalid = true },
+			dropped: []int{6},
+			rule:    RuleInvalid,
+		},
+		{
+			name:    "accuracy",
+			route:   func() []Location { return straightRoute(12, 5, 1) },
+			fixes:   func(f []Fix) { f[6].Accuracy = 100 },
+			opts:    func(o *Options) { o.MaxAccuracy = 50 },
+			dropped: []int{6},
+			rule:    RuleAccuracy,
+		},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		if tt.opts != nil {
+			tt.opts(&opts)
+		}
+		fixes := Fixes(tt.route())
+		if tt.fixes != nil {
+			tt.fixes(fixes)
+		}
+		_, report, err := AdjustFixesWithReport(fixes, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := report.Dropped(); !reflect.DeepEqual(got, tt.dropped) {
+			t.Errorf("%s: dropped %v, want %v", tt.name, got, tt.dropped)
+			continue
+		}
+		for _, i := range tt.dropped {
+			if got := report.Points[i].Rule; got != tt.rule {
+				t.Errorf("%s: point %d dropped by rule %q, want %q", tt.name, i, got, tt.rule)
+			}
+		}
+	}
+}
+
+func TestRuleOfKeptPoints(t *testing.T) {
+	raw := straightRoute(12, 5, 1)
+	raw[6] = shift(raw[6], 0, 1000)
+	_, report, err := AdjustRouteWithReport(raw, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range report.Points {
+		want := RuleNone
+		if p.Index >= 5 && p.Index <= 7 {
+			// the outlier and both its neighbours
+			want = RuleSpeed
+		}
+		if p.Rule != want || (p.Suspicion > 0) != (want != RuleNone) {
+			t.Errorf("point %d: %s with suspicion %d and rule %q, want rule %q", p.Index, p.Decision, p.Suspicion, p.Rule, want)
+		}
+	}
+}
+
+func TestAdjustRoutePinned(t *testing.T) {
+	// the output of the filter on a fixed route, which a rework of the
+	// filter must not change
+	raw := randomRoute(rand.New(rand.NewSource(7)), 80)
+	dropped := []int{4, 10, 13, 18, 25, 47, 54, 59, 64, 65, 66, 74, 78}
+
+	route, report, err := AdjustRouteWithReport(raw, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Dropped(); !reflect.DeepEqual(got, dropped) {
+		t.Fatalf("dropped %v, want %v", got, dropped)
+	}
+	if report.Iterations != 2 || !report.Converged {
+		t.Errorf("ran %d passes, converged %v, want 2 passes and convergence", report.Iterations, report.Converged)
+	}
+	var want []Location
+	for i, loc := range raw {
+		if len(dropped) > 0 && dropped[0] == i {
+			dropped = dropped[1:]
+			continue
+		}
+		want = append(want, loc)
+	}
+	if !reflect.DeepEqual(route, want) {
+		t.Errorf("got route %v, want %v", route, want)
+	}
+}
+
+func benchmarkAdjustRoute(b *testing.B, n int) {
+	raw := randomRoute(rand.New(rand.NewSource(1)), n)
+	opts := DefaultOptions()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := AdjustRoute(raw, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdjustRoute1k(b *testing.B)   { benchmarkAdjustRoute(b, 1000) }
+func BenchmarkAdjustRoute100k(b *testing.B) { benchmarkAdjustRoute(b, 100000) }
+func BenchmarkAdjustRoute1M(b *testing.B)   { benchmarkAdjustRoute(b, 1000000) }
@@ -0,0 +1,83 @@
+package adjust
+
+// Status labels a point of an annotated route.
+type Status string
+
+const (
+	// StatusValid marks a point no rule ever fired on.
+	StatusValid Status = "valid"
+	// StatusSuspicious marks a point some rule fired on but that the filter kept.
+	StatusSuspicious Status = "suspicious"
+	// StatusRemoved marks a point the filter dropped.
+	StatusRemoved Status = "removed"
+)
+
+// AnnotatedLocation is a point of the input route labelled by the filter.
+type AnnotatedLocation struct {
+	Location
+	Status Status `json:"status"`
+	// Iteration is the 1-based pass that removed the point, 0 if it was
+	// kept or removed before the first pass.
+	Iteration int `json:"iteration"`
+	// Confidence is 1 for a point no rule fired on and falls towards 0 as
+	// the point collects suspicion. It is 0 for a point a rule removed.
+	Confidence float64 `json:"confidence"`
+}
+
+// AnnotateRoute runs the filter of AdjustRoute but keeps every point of
+// rawRoute, labelling each with its status instead of deleting it. Like the
+// route of AdjustRoute, every point is in opts.OutputDatum when that is set.
+func AnnotateRoute(rawRoute []Location, opts Options) ([]AnnotatedLocation, error) {
+	_, report, err := AdjustRouteWithReport(rawRoute, opts)
+	if err != nil {
+		return []AnnotatedLocation{}, err
+	}
+	annotated := report.Annotate(rawRoute)
+	if from := opts.Datum; opts.OutputDatum != "" {
+		if from == "" {
+			from = WGS84
+		}
+		for i := range annotated {
+			annotated[i].Location, _ = ConvertLocation(annotated[i].Location, from, opts.OutputDatum)
+		}
+	}
+	return annotated, nil
+}
+
+// Annotate labels the points of rawRoute, the route the report was built
+// from. The points stay in the datum of rawRoute.
+func (r *Report) Annotate(rawRoute []Location) []AnnotatedLocation {
+	annotated := make([]AnnotatedLocation, len(r.Points))
+	for i, p := range r.Points {
+		status := StatusValid
+		confidence := 1.0 / float64(1+p.Suspicion)
+		if p.Decision == DecisionDrop {
+			status = StatusRemoved
+			if p.Rule != RuleNone {
+				// points dropped before the first pass have no suspicion
+				confidence = 0
+			}
+		} else if p.Suspicion > 0 {
+			status = StatusSuspicious
+		}
+		annotated[i] = AnnotatedLocation{
+			Location:   rawRoute[p.Index],
+			Status:     status,
+			Iteration:  p.Iteration,
+			Confidence: confidence,
+		}
+	}
+	return annotated
+}
+
+// KeptLocations returns the points that were not removed. For the output of
+// AnnotateRoute this is the route AdjustRoute returns with the same options.
+func KeptLocations(annotated []AnnotatedLocation) []Location {
+	var route []Location
+	for _, a := range annotated {
+		if a.Status != StatusRemoved {
+			route = append(route, a.Location)
+		}
+	}
+	return route
+}
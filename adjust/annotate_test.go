@@ -0,0 +1,55 @@
+package adjust
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestKeptLocationsInOutputDatum(t *testing.T) {
+	raw := straightRoute(12, 5, 1)
+	raw[6] = shift(raw[6], 0, 1000)
+	opts := DefaultOptions()
+	opts.OutputDatum = GCJ02
+
+	want, err := AdjustRoute(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated, err := AnnotateRoute(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := KeptLocations(annotated); !reflect.DeepEqual(got, want) {
+		t.Errorf("KeptLocations = %v, want the route of AdjustRoute %v", got, want)
+	}
+}
+
+func TestAnnotateConfidence(t *testing.T) {
+	raw := Fixes(straightRoute(12, 5, 1))
+	raw[3].Accuracy = 200
+	raw[6].Location = shift(raw[6].Location, 0, 1000)
+	raw[9].Lat = math.NaN()
+	opts := DefaultOptions()
+	opts.MaxAccuracy = 50
+	opts.DropInvalid = true
+
+	_, report, err := AdjustFixesWithReport(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range report.Annotate(Locations(raw)) {
+		want := 1.0
+		switch i {
+		case 3, 6, 9:
+			// dropped by the accuracy, speed and invalid rules
+			want = 0
+		case 5, 7:
+			// neighbours of the outlier
+			want = 0.5
+		}
+		if a.Confidence != want {
+			t.Errorf("point %d %s: confidence %v, want %v", i, a.Status, a.Confidence, want)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package adjust
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFormat names the encoding of a pipeline configuration.
+type ConfigFormat string
+
+const (
+	FormatJSON ConfigFormat = "json"
+	FormatYAML ConfigFormat = "yaml"
+)
+
+// Params holds the parameters of a configured stage by name.
+type Params map[string]interface{}
+
+// StageConfig configures one stage of a pipeline.
+type StageConfig struct {
+	Name   string `json:"name" yaml:"name"`
+	Params Params `json:"params" yaml:"params"`
+}
+
+// Config describes a pipeline and the parameters each city overrides.
+type Config struct {
+	Stages []StageConfig `json:"stages" yaml:"stages"`
+	// Overrides maps a city to the parameters it overrides, by stage name.
+	Overrides map[string]map[string]Params `json:"overrides" yaml:"overrides"`
+}
+
+// ConfigError reports a configuration value that cannot be used, Key being
+// its path in the configuration such as "stages[1].params.max_speed".
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("adjust: config %s: %v", e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// LoadConfig reads and validates the configuration in file path, its
+// format taken from the extension .json, .yaml or .yml.
+func LoadConfig(path string) (*Config, error) {
+	var format ConfigFormat
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = FormatJSON
+	case ".yaml", ".yml":
+		format = FormatYAML
+	default:
+		return nil, fmt.Errorf("adjust: config %s: unknown file extension", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data, format)
+}
+
+// ParseConfig decodes and validates a configuration.
+func ParseConfig(data []byte, format ConfigFormat) (*Config, error) {
+	config := &Config{}
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			return nil, fmt.Errorf("adjust: config: %v", err)
+		}
+	case FormatYAML:
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("adjust: config: %v", err)
+		}
+	default:
+		return nil, &OptionError{"format", format, "is not a known config format"}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate builds the pipeline of every city and returns a *ConfigError
+// for the first bad value.
+func (c *Config) Validate() error {
+	if len(c.Stages) == 0 {
+		return &ConfigError{"stages", fmt.Errorf("no stage configured")}
+	}
+	if _, err := c.Pipeline(""); err != nil {
+		return err
+	}
+	for _, city := range c.Cities() {
+		if _, err := c.Pipeline(city); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cities returns the cities with overrides in sorted order.
+func (c *Config) Cities() []string {
+	cities := make([]string, 0, len(c.Overrides))
+	for city := range c.Overrides {
+		cities = append(cities, city)
+	}
+	sort.Strings(cities)
+	return cities
+}
+
+// Pipeline builds the pipeline for city, applying its overrides. An empty
+// city or one without overrides gets the base pipeline.
+func (c *Config) Pipeline(city string) (*Pipeline, error) {
+	overrides := c.Overrides[city]
+	for name := range overrides {
+		if _, ok := stageBuilders[name]; !ok {
+			return nil, &ConfigError{fmt.Sprintf("overrides.%s.%s", city, name), fmt.Errorf("unknown stage")}
+		}
+		found := false
+		for _, sc := range c.Stages {
+			found = found || sc.Name == name
+		}
+		if !found {
+			return nil, &ConfigError{fmt.Sprintf("overrides.%s.%s", city, name), fmt.Errorf("stage is not in the pipeline")}
+		}
+	}
+
+	pipeline := NewPipeline()
+	for i, sc := range c.Stages {
+		key := fmt.Sprintf("stages[%d]", i)
+		build, ok := stageBuilders[sc.Name]
+		if !ok {
+			return nil, &ConfigError{key + ".name", fmt.Errorf("unknown stage %q", sc.Name)}
+		}
+
+		p := &stageParams{key: key, params: make(map[string]*stageParam)}
+		for name, value := range sc.Params {
+			p.params[name] = &stageParam{value: value, key: key + ".params." + name}
+		}
+		for name, value := range overrides[sc.Name] {
+			p.params[name] = &stageParam{value: value, key: fmt.Sprintf("overrides.%s.%s.%s", city, sc.Name, name)}
+		}
+
+		stage, err := build(p)
+		if err == nil {
+			err = p.checkUnused()
+		}
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Stages = append(pipeline.Stages, stage)
+	}
+	return pipeline, nil
+}
+
+// stageParam is a configured parameter along with the key it came from.
+type stageParam struct {
+	value interface{}
+	key   string
+	used  bool
+}
+
+// stageParams holds the parameters of the stage configured at key.
+type stageParams struct {
+	key    string
+	params map[string]*stageParam
+}
+
+// keyOf returns the key of parameter name, whether it is configured or not.
+func (p *stageParams) keyOf(name string) string {
+	if param, ok := p.params[name]; ok {
+		return param.key
+	}
+	return p.key + ".params." + name
+}
+
+func (p *stageParams) lookup(name string) (*stageParam, bool) {
+	param, ok := p.params[name]
+	if ok {
+		param.used = true
+	}
+	return param, ok
+}
+
+func (p *stageParams) float(name string, dst *float64) error {
+	param, ok := p.lookup(name)
+	if !ok {
+		return nil
+	}
+	switch v := param.value.(type) {
+	case float64:
+		*dst = v
+	case int:
+		*dst = float64(v)
+	default:
+		return &ConfigError{param.key, fmt.Errorf("want a number, got %v", param.value)}
+	}
+	return nil
+}
+
+func (p *stageParams) int(name string, dst *int) error {
+	param, ok := p.lookup(name)
+	if !ok {
+		return nil
+	}
+	switch v := param.value.(type) {
+	case int:
+		*dst = v
+	case float64:
+		if v != float64(int(v)) {
+			return &ConfigError{param.key, fmt.Errorf("want an integer, got %v", v)}
+		}
+		*dst = int(v)
+	default:
+		return &ConfigError{param.key, fmt.Errorf("want an integer, got %v", param.value)}
+	}
+	return nil
+}
+
+func (p *stageParams) bool(name string, dst *bool) error {
+	param, ok := p.lookup(name)
+	if !ok {
+		return nil
+	}
+	v, ok := param.value.(bool)
+	if !ok {
+		return &ConfigError{param.key, fmt.Errorf("want true or false, got %v", param.value)}
+	}
+	*dst = v
+	return nil
+}
+
+func (p *stageParams) string(name string, dst *string) error {
+	param, ok := p.lookup(name)
+	if !ok {
+		return nil
+	}
+	v, ok := param.value.(string)
+	if !ok {
+		return &ConfigError{param.key, fmt.Errorf("want a string, got %v", param.value)}
+	}
+	*dst = v
+	return nil
+}
+
+// firstError returns the first of errs that is not nil.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnused reports the first parameter, by key, that the stage does not know.
+func (p *stageParams) checkUnused() error {
+	var keys []string
+	for _, param := range p.params {
+		if !param.used {
+			keys = append(keys, param.key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return &ConfigError{keys[0], fmt.Errorf("unknown parameter")}
+}
+
+// validated turns an *OptionError of a built stage into a *ConfigError
+// pointing at the parameter that fields maps its field to.
+func (p *stageParams) validated(err error, fields map[string]string) error {
+	if err == nil {
+		return nil
+	}
+	if optErr, ok := err.(*OptionError); ok {
+		if name, ok := fields[optErr.Field]; ok {
+			return &ConfigError{p.keyOf(name), err}
+		}
+	}
+	return &ConfigError{p.key, err}
+}
+
+var stageBuilders = map[string]func(p *stageParams) (Stage, error){
+	StageValidate: func(p *stageParams) (Stage, error) {
+		s := ValidateStage{}
+		err := p.bool("drop", &s.Drop)
+		return s, err
+	},
+	StageTimestamps: func(p *stageParams) (Stage, error) {
+		policy := DefaultTimestampPolicy()
+		backwards, duplicates := string(policy.Backwards), string(policy.Duplicates)
+		if err := firstError(
+			p.bool("sort", &policy.Sort),
+			p.string("backwards", &backwards),
+			p.string("duplicates", &duplicates),
+		); err != nil {
+			return nil, err
+		}
+		policy.Backwards, policy.Duplicates = BackwardsPolicy(backwards), DuplicatePolicy(duplicates)
+		return TimestampStage{policy}, p.validated(policy.Validate(), map[string]string{
+			"Backwards":  "backwards",
+			"Duplicates": "duplicates",
+		})
+	},
+	StageFilter: func(p *stageParams) (Stage, error) {
+		opts := DefaultOptions()
+		profile := ""
+		if err := p.string("profile", &profile); err != nil {
+			return nil, err
+		}
+		if profile != "" {
+			prof, err := LookupProfile(profile)
+			if err != nil {
+				return nil, &ConfigError{p.keyOf("profile"), err}
+			}
+			opts = prof.Options()
+		}
+
+		datum, outputDatum := string(opts.Datum), string(opts.OutputDatum)
+		spike, withSpike := DefaultSpikeOptions(), false
+		if err := firstError(
+			p.float("max_speed", &opts.MaxSpeed),
+			p.float("speed_factor", &opts.SpeedFactor),
+			p.int("iterations", &opts.Iterations),
+			p.int("precision", &opts.Precision),
+			p.bool("cluster_by_geohash", &opts.ClusterByGeohash),
+			p.float("max_acceleration", &opts.MaxAcceleration),
+			p.float("max_jerk", &opts.MaxJerk),
+			p.bool("drop_invalid", &opts.DropInvalid),
+			p.float("max_accuracy", &opts.MaxAccuracy),
+			p.bool("prefer_accurate", &opts.PreferAccurate),
+			p.float("max_gap", &opts.MaxGap),
+			p.float("gap_speed", &opts.GapSpeed),
+			p.string("datum", &datum),
+			p.string("output_datum", &outputDatum),
+			p.bool("spike", &withSpike),
+			p.float("spike_min_turn", &spike.MinTurn),
+			p.float("spike_min_ratio", &spike.MinRatio),
+			p.float("spike_min_distance", &spike.MinDistance),
+		); err != nil {
+			return nil, err
+		}
+		opts.Datum, opts.OutputDatum = Datum(datum), Datum(outputDatum)
+		if withSpike {
+			opts.Spike = &spike
+		}
+		return FilterStage{opts}, p.validated(opts.Validate(), map[string]string{
+			"MaxSpeed":          "max_speed",
+			"SpeedFactor":       "speed_factor",
+			"Iterations":        "iterations",
+			"Precision":         "precision",
+			"MaxAcceleration":   "max_acceleration",
+			"MaxJerk":           "max_jerk",
+			"MaxAccuracy":       "max_accuracy",
+			"MaxGap":            "max_gap",
+			"GapSpeed":          "gap_speed",
+			"Datum":             "datum",
+			"OutputDatum":       "output_datum",
+			"Spike.MinTurn":     "spike_min_turn",
+			"Spike.MinRatio":    "spike_min_ratio",
+			"Spike.MinDistance": "spike_min_distance",
+		})
+	},
+	StageKalman: func(p *stageParams) (Stage, error) {
+		opts := DefaultKalmanOptions()
+		if err := firstError(
+			p.float("process_noise", &opts.ProcessNoise),
+			p.float("measurement_noise", &opts.MeasurementNoise),
+			p.bool("smooth", &opts.Smooth),
+		); err != nil {
+			return nil, err
+		}
+		return KalmanStage{opts}, p.validated(opts.Validate(), map[string]string{
+			"ProcessNoise":     "process_noise",
+			"MeasurementNoise": "measurement_noise",
+		})
+	},
+	StageSimplify: func(p *stageParams) (Stage, error) {
+		s := SimplifyStage{Method: SimplifyDP}
+		method := string(s.Method)
+		if err := firstError(
+			p.string("method", &method),
+			p.float("tolerance", &s.Tolerance),
+		); err != nil {
+			return nil, err
+		}
+		s.Method = SimplifyMethod(method)
+		if s.Method != SimplifyDP && s.Method != SimplifyVW {
+			return nil, &ConfigError{p.keyOf("method"), fmt.Errorf("unknown method %q", method)}
+		}
+		return s, p.validated(validateTolerance(s.Tolerance), map[string]string{"tolerance": "tolerance"})
+	},
+	StageResample: func(p *stageParams) (Stage, error) {
+		opts := ResampleOptions{}
+		if err := firstError(
+			p.float("interval", &opts.Interval),
+			p.float("max_gap", &opts.MaxGap),
+		); err != nil {
+			return nil, err
+		}
+		return ResampleStage{opts}, p.validated(opts.Validate(), map[string]string{
+			"Interval": "interval",
+			"MaxGap":   "max_gap",
+		})
+	},
+	StageFillGaps: func(p *stageParams) (Stage, error) {
+		opts := GapFillOptions{}
+		if err := firstError(
+			p.float("max_gap", &opts.MaxGap),
+			p.float("interval", &opts.Interval),
+		); err != nil {
+			return nil, err
+		}
+		return FillGapsStage{opts}, p.validated(opts.Validate(), map[string]string{
+			"MaxGap":   "max_gap",
+			"Interval": "interval",
+		})
+	},
+}
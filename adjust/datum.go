@@ -0,0 +1,211 @@
+package adjust
+
+import (
+	"math"
+
+	mgeo "github.com/eleme/clair/matrix/geo"
+)
+
+// Datum names the coordinate system of a location.
+type Datum string
+
+const (
+	// WGS84 is the datum of raw GPS fixes.
+	WGS84 Datum = "wgs84"
+	// GCJ02 is the obfuscated datum required for maps of mainland China.
+	GCJ02 Datum = "gcj02"
+	// BD09 is the datum of Baidu maps, derived from GCJ02.
+	BD09 Datum = "bd09"
+)
+
+const bdXPi = math.Pi * 3000.0 / 180.0
+
+// DefaultGCJTolerance is the precision in degrees, about 0.1 mm, that
+// GCJtoWGS inverts GCJ-02 to.
+const DefaultGCJTolerance = 1e-9
+
+// maxGCJIterations bounds the fixed-point iteration of GCJtoWGSWithTolerance,
+// which converges within a handful of steps.
+const maxGCJIterations = 30
+
+// chinaRegion is a rectangle given by its north-west and south-east corners.
+type chinaRegion struct {
+	north, west, south, east float64
+}
+
+func (r chinaRegion) contains(lat, lng float64) bool {
+	return lat <= r.north && lat >= r.south && lng >= r.west && lng <= r.east
+}
+
+// mainland China, where the GCJ-02 offset applies, as a union of rectangles
+// minus the neighbouring areas they overlap
+var (
+	chinaRegions = []chinaRegion{
+		{49.220400, 79.446200, 42.889900, 96.330000},
+		{54.141500, 109.687200, 39.374200, 135.000200},
+		{42.889900, 73.124600, 29.529700, 124.143255},
+		{29.529700, 82.968400, 26.718600, 97.035200},
+		{29.529700, 97.025300, 20.414096, 124.367395},
+		{20.414096, 107.975793, 17.871542, 111.744104},
+	}
+	chinaExclusions = []chinaRegion{
+		{25.398623, 119.921265, 21.785006, 122.497559},
+		{22.284000, 101.865200, 20.098800, 106.665000},
+		{21.542200, 106.452500, 20.487800, 108.051000},
+		{55.817500, 109.032300, 50.325700, 119.127000},
+		{55.817500, 127.456800, 49.557400, 137.022700},
+		{44.892200, 131.266200, 42.569200, 137.022700},
+	}
+)
+
+// OutOfChina tells whether a coordinate lies outside the area where GCJ-02
+// differs from WGS-84: mainland China along with Hong Kong and Macau, but
+// not Taiwan. The area is approximated by rectangles, so right at its
+// border the answer may be off.
+func OutOfChina(lat, lng float64) bool {
+	for _, r := range chinaRegions {
+		if r.contains(lat, lng) {
+			for _, x := range chinaExclusions {
+				if x.contains(lat, lng) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// WGStoGCJ converts from WGS-84 to GCJ-02, leaving coordinates for which
+// OutOfChina holds unchanged.
+func WGStoGCJ(wgsLat, wgsLng float64) (gcjLat, gcjLng float64) {
+	if OutOfChina(wgsLat, wgsLng) {
+		return wgsLat, wgsLng
+	}
+	return mgeo.WGStoGCJ(wgsLat, wgsLng)
+}
+
+// GCJtoWGS converts from GCJ-02 to WGS-84 to within DefaultGCJTolerance.
+func GCJtoWGS(gcjLat, gcjLng float64) (wgsLat, wgsLng float64) {
+	return GCJtoWGSWithTolerance(gcjLat, gcjLng, DefaultGCJTolerance)
+}
+
+// GCJtoWGSWithTolerance converts from GCJ-02 to WGS-84 by refining the
+// estimate until shifting it by the GCJ-02 offset lands within tolerance
+// degrees of the input. A result for which OutOfChina holds was never
+// shifted, so the input comes back unchanged instead. Near the border both
+// can be exact, for a point inside that the offset carries across and for
+// one outside that is taken as is; the point inside wins.
+func GCJtoWGSWithTolerance(gcjLat, gcjLng, tolerance float64) (wgsLat, wgsLng float64) {
+	wgsLat, wgsLng = gcjLat, gcjLng
+	for i := 0; i < maxGCJIterations; i++ {
+		// the offset is applied unconditionally, since bypassing it once
+		// the estimate strays across the border stalls the iteration
+		lat, lng := mgeo.WGStoGCJ(wgsLat, wgsLng)
+		dLat, dLng := lat-gcjLat, lng-gcjLng
+		if math.Abs(dLat) < tolerance && math.Abs(dLng) < tolerance {
+			break
+		}
+		wgsLat, wgsLng = wgsLat-dLat, wgsLng-dLng
+	}
+	if OutOfChina(wgsLat, wgsLng) {
+		return gcjLat, gcjLng
+	}
+	return wgsLat, wgsLng
+}
+
+// Validate returns an *OptionError unless d is a known datum.
+func (d Datum) Validate() error {
+	switch d {
+	case WGS84, GCJ02, BD09:
+		return nil
+	}
+	return &OptionError{"Datum", d, "is not a known datum"}
+}
+
+// GCJtoBD converts from GCJ-02 to BD-09.
+func GCJtoBD(gcjLat, gcjLng float64) (bdLat, bdLng float64) {
+	x, y := gcjLng, gcjLat
+	z := math.Sqrt(x*x+y*y) + 0.00002*math.Sin(y*bdXPi)
+	theta := math.Atan2(y, x) + 0.000003*math.Cos(x*bdXPi)
+	return z*math.Sin(theta) + 0.006, z*math.Cos(theta) + 0.0065
+}
+
+// BDtoGCJ converts from BD-09 to GCJ-02.
+func BDtoGCJ(bdLat, bdLng float64) (gcjLat, gcjLng float64) {
+	x, y := bdLng-0.0065, bdLat-0.006
+	z := math.Sqrt(x*x+y*y) - 0.00002*math.Sin(y*bdXPi)
+	theta := math.Atan2(y, x) - 0.000003*math.Cos(x*bdXPi)
+	return z * math.Sin(theta), z * math.Cos(theta)
+}
+
+// ConvertLocation returns loc, given in datum from, in datum to.
+func ConvertLocation(loc Location, from, to Datum) (Location, error) {
+	if err := from.Validate(); err != nil {
+		return loc, err
+	}
+	if err := to.Validate(); err != nil {
+		return loc, err
+	}
+	if from == to {
+		return loc, nil
+	}
+
+	// every conversion goes through GCJ-02
+	switch from {
+	case WGS84:
+		loc.Lat, loc.Lng = WGStoGCJ(loc.Lat, loc.Lng)
+	case BD09:
+		loc.Lat, loc.Lng = BDtoGCJ(loc.Lat, loc.Lng)
+	}
+	switch to {
+	case WGS84:
+		loc.Lat, loc.Lng = GCJtoWGS(loc.Lat, loc.Lng)
+	case BD09:
+		loc.Lat, loc.Lng = GCJtoBD(loc.Lat, loc.Lng)
+	}
+	return loc, nil
+}
+
+// ConvertRoute returns a copy of route, given in datum from, in datum to.
+func ConvertRoute(route []Location, from, to Datum) ([]Location, error) {
+	converted := make([]Location, len(route))
+	for i, loc := range route {
+		var err error
+		if converted[i], err = ConvertLocation(loc, from, to); err != nil {
+			return []Location{}, err
+		}
+	}
+	return converted, nil
+}
+
+// Route is a sequence of locations tagged with their datum.
+type Route struct {
+	Datum     Datum      `json:"datum"`
+	Locations []Location `json:"locations"`
+}
+
+// To returns the route converted to datum d.
+func (r Route) To(d Datum) (Route, error) {
+	locations, err := ConvertRoute(r.Locations, r.Datum, d)
+	if err != nil {
+		return Route{}, err
+	}
+	return Route{d, locations}, nil
+}
+
+// Adjust filters the route with AdjustRoute, reading its datum from the
+// route. The result is in opts.OutputDatum, or in the datum of the route
+// when that is empty.
+func (r Route) Adjust(opts Options) (Route, error) {
+	opts.Datum = r.Datum
+	locations, err := AdjustRoute(r.Locations, opts)
+	if err != nil {
+		return Route{}, err
+	}
+	d := opts.OutputDatum
+	if d == "" {
+		d = r.Datum
+	}
+	return Route{d, locations}, nil
+}
@@ -0,0 +1,80 @@
+package adjust
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestOutOfChina(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     bool
+	}{
+		{"Beijing", 39.9042, 116.4074, false},
+		{"Shanghai", 31.2304, 121.4737, false},
+		{"Urumqi", 43.8256, 87.6168, false},
+		{"Hong Kong", 22.3193, 114.1694, false},
+		{"Macau", 22.1987, 113.5439, false},
+		{"Taipei", 25.0330, 121.5654, true},
+		{"Hanoi", 21.0278, 105.8342, true},
+		{"Seoul", 37.5665, 126.9780, true},
+		{"Tokyo", 35.6762, 139.6503, true},
+		{"London", 51.5074, -0.1278, true},
+	}
+	for _, tt := range tests {
+		if got := OutOfChina(tt.lat, tt.lng); got != tt.want {
+			t.Errorf("OutOfChina(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// roundTrip returns the distance in metres between a WGS-84 coordinate and
+// the result of converting it to GCJ-02 and back.
+func roundTrip(lat, lng float64) float64 {
+	gcjLat, gcjLng := WGStoGCJ(lat, lng)
+	wgsLat, wgsLng := GCJtoWGS(gcjLat, gcjLng)
+	return getDistance(Location{Lat: lat, Lng: lng}, Location{Lat: wgsLat, Lng: wgsLng})
+}
+
+func TestGCJRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{"Beijing", 39.9042, 116.4074},
+		{"Shanghai", 31.2304, 121.4737},
+		{"Chengdu", 30.5728, 104.0668},
+		{"Urumqi", 43.8256, 87.6168},
+		{"Haikou", 20.0440, 110.1999},
+		// inside, but shifted across the border by the offset
+		{"Yellow Sea border", 36.91073, 124.14194},
+		{"Tumen border", 42.86284, 131.26471},
+		{"Hong Kong", 22.3193, 114.1694},
+		// outside, where nothing is shifted
+		{"Taipei", 25.0330, 121.5654},
+		{"Seoul", 37.5665, 126.9780},
+		{"Tokyo", 35.6762, 139.6503},
+		{"London", 51.5074, -0.1278},
+	}
+	for _, tt := range tests {
+		if d := roundTrip(tt.lat, tt.lng); d > 0.01 {
+			t.Errorf("%s: round trip off by %.3f m", tt.name, d)
+		}
+	}
+}
+
+func TestGCJRoundTripInChina(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	checked := 0
+	for checked < 20000 {
+		lat, lng := 18+r.Float64()*36, 73+r.Float64()*62
+		if OutOfChina(lat, lng) {
+			continue
+		}
+		checked++
+		if d := roundTrip(lat, lng); d > 0.01 {
+			t.Fatalf("(%v, %v): round trip off by %.3f m", lat, lng, d)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package adjust
+
+// user equivalent range error in metres, turns HDOP into an accuracy
+const uere = 5.0
+
+// Provider names the source of a fix.
+type Provider string
+
+const (
+	ProviderGPS     Provider = "gps"
+	ProviderNetwork Provider = "network"
+	ProviderFused   Provider = "fused"
+)
+
+// Fix is a Location along with what the receiver reported about it. All
+// fields besides the Location are optional and zero when unknown.
+type Fix struct {
+	Location
+	// Accuracy is the horizontal accuracy in metres.
+	Accuracy float64
+	// HDOP is the horizontal dilution of precision.
+	HDOP float64
+	// Satellites is the number of satellites used for the fix.
+	Satellites int
+	// Provider is the source of the fix.
+	Provider Provider
+	// Elevation is the height above mean sea level in metres.
+	Elevation float64
+	// Synthetic marks a point made up by interpolation rather than measured.
+	Synthetic bool
+}
+
+// HorizontalAccuracy returns Accuracy, or an estimate from HDOP when only
+// that is known, or zero when neither is.
+func (f Fix) HorizontalAccuracy() float64 {
+	if f.Accuracy > 0 {
+		return f.Accuracy
+	}
+	if f.HDOP > 0 {
+		return f.HDOP * uere
+	}
+	return 0
+}
+
+// Fixes returns the locations of route as fixes without metadata.
+func Fixes(route []Location) []Fix {
+	fixes := make([]Fix, len(route))
+	for i, loc := range route {
+		fixes[i].Location = loc
+	}
+	return fixes
+}
+
+// Locations returns the location of every fix.
+func Locations(fixes []Fix) []Location {
+	route := make([]Location, len(fixes))
+	for i, f := range fixes {
+		route[i] = f.Location
+	}
+	return route
+}
+
+// horizontalAccuracies returns the horizontal accuracy of every fix.
+func horizontalAccuracies(fixes []Fix) []float64 {
+	accuracies := make([]float64, len(fixes))
+	for i, f := range fixes {
+		accuracies[i] = f.HorizontalAccuracy()
+	}
+	return accuracies
+}
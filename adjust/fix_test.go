@@ -0,0 +1,71 @@
+package adjust
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHorizontalAccuracy(t *testing.T) {
+	tests := []struct {
+		fix  Fix
+		want float64
+	}{
+		{Fix{}, 0},
+		{Fix{Accuracy: 12}, 12},
+		{Fix{HDOP: 2}, 2 * uere},
+		{Fix{Accuracy: 12, HDOP: 2}, 12},
+	}
+	for _, tt := range tests {
+		if got := tt.fix.HorizontalAccuracy(); got != tt.want {
+			t.Errorf("%+v: HorizontalAccuracy() = %v, want %v", tt.fix, got, tt.want)
+		}
+	}
+}
+
+func TestFixesRoundTrip(t *testing.T) {
+	// Location keeps its three fields, so positional literals still work
+	route := []Location{{22.1, 112.2, 1513590840}, {22.1001, 112.2, 1513590845}}
+	fixes := Fixes(route)
+	if fixes[1].Location != route[1] || fixes[1].Accuracy != 0 {
+		t.Errorf("Fixes(%v) = %+v", route, fixes)
+	}
+	if got := Locations(fixes); !reflect.DeepEqual(got, route) {
+		t.Errorf("Locations(Fixes(%v)) = %v", route, got)
+	}
+}
+
+func TestAccuracyOnlyWithFixes(t *testing.T) {
+	raw := straightRoute(12, 5, 1)
+	raw[6] = shift(raw[6], 0, 1000)
+	fixes := Fixes(raw)
+	fixes[2].Accuracy = 100
+	fixes[6].Accuracy = 30
+	fixes[7].Accuracy = 5
+	opts := DefaultOptions()
+	opts.MaxAccuracy = 50
+	opts.PreferAccurate = true
+
+	// plain locations have no accuracy, so only the outlier goes
+	route, err := AdjustRoute(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(route) != len(raw)-1 {
+		t.Errorf("AdjustRoute kept %d points, want %d", len(route), len(raw)-1)
+	}
+
+	kept, report, err := AdjustFixesWithReport(fixes, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := report.Dropped(), []int{2, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dropped %v, want %v", got, want)
+	}
+	// the accurate neighbour takes none of the suspicion of the outlier
+	if p := report.Points[7]; p.Suspicion != 0 {
+		t.Errorf("point 7 has suspicion %d, want 0", p.Suspicion)
+	}
+	if f := kept[5]; f.Location != raw[7] || f.Accuracy != 5 {
+		t.Errorf("kept %+v for point 7, want it with its accuracy", f)
+	}
+}
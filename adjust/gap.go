@@ -0,0 +1,86 @@
+package adjust
+
+import "math"
+
+// GapInterpolator reconstructs the stretch of a route that was not recorded
+// between two fixes, such as a tunnel.
+type GapInterpolator interface {
+	// Interpolate returns one point for each of times, which all lie
+	// between from.UTC and to.UTC.
+	Interpolate(from, to Location, times []float64) ([]Location, error)
+}
+
+// StraightLine interpolates along the great circle between the two fixes.
+type StraightLine struct{}
+
+func (StraightLine) Interpolate(from, to Location, times []float64) ([]Location, error) {
+	points := make([]Location, len(times))
+	for i, t := range times {
+		points[i] = interpolate(from, to, (t-from.UTC)/(to.UTC-from.UTC))
+	}
+	return points, nil
+}
+
+// GapFillOptions controls FillGaps.
+type GapFillOptions struct {
+	// MaxGap is the longest time in seconds between two fixes that is left
+	// alone, longer gaps are filled.
+	MaxGap float64
+	// Interval is the time in seconds between two synthetic points.
+	Interval float64
+	// Interpolator makes up the synthetic points, nil means StraightLine.
+	Interpolator GapInterpolator
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o GapFillOptions) Validate() error {
+	if !(o.MaxGap > 0) || math.IsInf(o.MaxGap, 0) {
+		return &OptionError{"MaxGap", o.MaxGap, "must be a positive finite number"}
+	}
+	if !(o.Interval > 0) || math.IsInf(o.Interval, 0) {
+		return &OptionError{"Interval", o.Interval, "must be a positive finite number"}
+	}
+	return nil
+}
+
+// FillGaps inserts points every opts.Interval seconds into each gap of
+// route longer than opts.MaxGap, leaving the fixes of route as they are.
+func FillGaps(route []Location, opts GapFillOptions) ([]Location, error) {
+	fixes, err := FillGapsFixes(Fixes(route), opts)
+	if err != nil {
+		return []Location{}, err
+	}
+	return Locations(fixes), nil
+}
+
+// FillGapsFixes is like FillGaps but marks the inserted points Synthetic.
+// They carry no other metadata.
+func FillGapsFixes(route []Fix, opts GapFillOptions) ([]Fix, error) {
+	if err := opts.Validate(); err != nil {
+		return []Fix{}, err
+	}
+	interpolator := opts.Interpolator
+	if interpolator == nil {
+		interpolator = StraightLine{}
+	}
+
+	var filled []Fix
+	for i, fix := range route {
+		if i > 0 && fix.UTC-route[i-1].UTC > opts.MaxGap {
+			from := route[i-1]
+			var times []float64
+			for t := from.UTC + opts.Interval; t < fix.UTC; t += opts.Interval {
+				times = append(times, t)
+			}
+			points, err := interpolator.Interpolate(from.Location, fix.Location, times)
+			if err != nil {
+				return []Fix{}, err
+			}
+			for _, p := range points {
+				filled = append(filled, Fix{Location: p, Synthetic: true})
+			}
+		}
+		filled = append(filled, fix)
+	}
+	return filled, nil
+}
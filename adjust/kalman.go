@@ -0,0 +1,191 @@
+package adjust
+
+import "math"
+
+const (
+	DefaultProcessNoise     = 1.0
+	DefaultMeasurementNoise = 10.0
+
+	// standard deviation in m/s of the unknown initial velocity
+	initialVelocityNoise = 50.0
+)
+
+// KalmanOptions controls the Kalman smoothing of KalmanSmooth.
+type KalmanOptions struct {
+	// ProcessNoise is the spectral density of the random acceleration in
+	// m²/s³, larger values let the track follow sharper manoeuvres.
+	ProcessNoise float64
+	// MeasurementNoise is the standard deviation in metres of a GPS fix,
+	// used for the fixes whose horizontal accuracy is unknown.
+	MeasurementNoise float64
+	// Smooth runs the Rauch–Tung–Striebel backward pass after the forward
+	// filter, so every point also benefits from the fixes after it.
+	Smooth bool
+}
+
+// DefaultKalmanOptions returns a setting suitable for phone GPS in a city.
+func DefaultKalmanOptions() KalmanOptions {
+	return KalmanOptions{
+		ProcessNoise:     DefaultProcessNoise,
+		MeasurementNoise: DefaultMeasurementNoise,
+		Smooth:           true,
+	}
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o KalmanOptions) Validate() error {
+	if !(o.ProcessNoise > 0) || math.IsInf(o.ProcessNoise, 0) {
+		return &OptionError{"ProcessNoise", o.ProcessNoise, "must be a positive finite number"}
+	}
+	if !(o.MeasurementNoise > 0) || math.IsInf(o.MeasurementNoise, 0) {
+		return &OptionError{"MeasurementNoise", o.MeasurementNoise, "must be a positive finite number"}
+	}
+	return nil
+}
+
+// mat2 and vec2 hold the covariance and the state, position and velocity,
+// of one axis of the constant-velocity model.
+type mat2 [2][2]float64
+type vec2 [2]float64
+
+func (a mat2) mul(b mat2) mat2 {
+	return mat2{
+		{a[0][0]*b[0][0] + a[0][1]*b[1][0], a[0][0]*b[0][1] + a[0][1]*b[1][1]},
+		{a[1][0]*b[0][0] + a[1][1]*b[1][0], a[1][0]*b[0][1] + a[1][1]*b[1][1]},
+	}
+}
+
+func (a mat2) add(b mat2) mat2 {
+	return mat2{{a[0][0] + b[0][0], a[0][1] + b[0][1]}, {a[1][0] + b[1][0], a[1][1] + b[1][1]}}
+}
+
+func (a mat2) sub(b mat2) mat2 {
+	return mat2{{a[0][0] - b[0][0], a[0][1] - b[0][1]}, {a[1][0] - b[1][0], a[1][1] - b[1][1]}}
+}
+
+func (a mat2) transpose() mat2 {
+	return mat2{{a[0][0], a[1][0]}, {a[0][1], a[1][1]}}
+}
+
+func (a mat2) inverse() mat2 {
+	det := a[0][0]*a[1][1] - a[0][1]*a[1][0]
+	return mat2{{a[1][1] / det, -a[0][1] / det}, {-a[1][0] / det, a[0][0] / det}}
+}
+
+func (a mat2) apply(v vec2) vec2 {
+	return vec2{a[0][0]*v[0] + a[0][1]*v[1], a[1][0]*v[0] + a[1][1]*v[1]}
+}
+
+// kalmanAxis smooths the positions z of one axis taken at times t, r[i]
+// being the measurement variance of z[i].
+func kalmanAxis(z, t, r []float64, opts KalmanOptions) []float64 {
+	n := len(z)
+	xf := make([]vec2, n) // filtered states
+	pf := make([]mat2, n) // filtered covariances
+	xp := make([]vec2, n) // predicted states
+	pp := make([]mat2, n) // predicted covariances
+	fs := make([]mat2, n) // transitions into each step
+
+	x := vec2{z[0], 0}
+	p := mat2{{r[0], 0}, {0, initialVelocityNoise * initialVelocityNoise}}
+	for i := 0; i < n; i++ {
+		f := mat2{{1, 0}, {0, 1}}
+		if i > 0 {
+			dt := t[i] - t[i-1]
+			if dt < 0 {
+				dt = 0
+			}
+			f[0][1] = dt
+			q := opts.ProcessNoise
+			qm := mat2{
+				{q * dt * dt * dt / 3.0, q * dt * dt / 2.0},
+				{q * dt * dt / 2.0, q * dt},
+			}
+			x = f.apply(x)
+			p = f.mul(p).mul(f.transpose()).add(qm)
+		}
+		fs[i], xp[i], pp[i] = f, x, p
+
+		// the measurement only observes the position
+		s := p[0][0] + r[i]
+		k := vec2{p[0][0] / s, p[1][0] / s}
+		innovation := z[i] - x[0]
+		x = vec2{x[0] + k[0]*innovation, x[1] + k[1]*innovation}
+		p = mat2{
+			{(1 - k[0]) * p[0][0], (1 - k[0]) * p[0][1]},
+			{p[1][0] - k[1]*p[0][0], p[1][1] - k[1]*p[0][1]},
+		}
+		xf[i], pf[i] = x, p
+	}
+
+	if opts.Smooth {
+		for i := n - 2; i >= 0; i-- {
+			c := pf[i].mul(fs[i+1].transpose()).mul(pp[i+1].inverse())
+			d := c.apply(vec2{xf[i+1][0] - xp[i+1][0], xf[i+1][1] - xp[i+1][1]})
+			xf[i] = vec2{xf[i][0] + d[0], xf[i][1] + d[1]}
+			pf[i] = pf[i].add(c.mul(pf[i+1].sub(pp[i+1])).mul(c.transpose()))
+		}
+	}
+
+	positions := make([]float64, n)
+	for i := range xf {
+		positions[i] = xf[i][0]
+	}
+	return positions
+}
+
+// KalmanSmooth runs a constant-velocity Kalman filter over route and
+// returns the smoothed track with the timestamps of route.
+func KalmanSmooth(route []Location, opts KalmanOptions) ([]Location, error) {
+	return kalmanSmooth(route, nil, opts)
+}
+
+// KalmanSmoothFixes is like KalmanSmooth but trusts every fix as much as
+// its horizontal accuracy says, when that is known. The smoothed fixes
+// keep their metadata.
+func KalmanSmoothFixes(fixes []Fix, opts KalmanOptions) ([]Fix, error) {
+	route, err := kalmanSmooth(Locations(fixes), horizontalAccuracies(fixes), opts)
+	if err != nil {
+		return []Fix{}, err
+	}
+	smoothed := make([]Fix, len(fixes))
+	for i, f := range fixes {
+		f.Location = route[i]
+		smoothed[i] = f
+	}
+	return smoothed, nil
+}
+
+// kalmanSmooth smooths route, taking the standard deviation of every fix
+// from accuracies where it is known, or from opts.MeasurementNoise.
+func kalmanSmooth(route []Location, accuracies []float64, opts KalmanOptions) ([]Location, error) {
+	if err := opts.Validate(); err != nil {
+		return []Location{}, err
+	}
+	if len(route) == 0 {
+		return []Location{}, nil
+	}
+
+	proj := newProjection(route[0])
+	xs := make([]float64, len(route))
+	ys := make([]float64, len(route))
+	ts := make([]float64, len(route))
+	rs := make([]float64, len(route))
+	for i, loc := range route {
+		xs[i], ys[i] = proj.toXY(loc)
+		ts[i] = loc.UTC
+		rs[i] = opts.MeasurementNoise * opts.MeasurementNoise
+		if accuracies != nil && accuracies[i] > 0 {
+			rs[i] = accuracies[i] * accuracies[i]
+		}
+	}
+	xs = kalmanAxis(xs, ts, rs, opts)
+	ys = kalmanAxis(ys, ts, rs, opts)
+
+	smoothed := make([]Location, len(route))
+	for i, loc := range route {
+		loc.Lat, loc.Lng = proj.toLatLng(xs[i], ys[i])
+		smoothed[i] = loc
+	}
+	return smoothed, nil
+}
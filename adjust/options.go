@@ -0,0 +1,136 @@
+package adjust
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	DefaultMaxSpeed    = 20.0
+	DefaultSpeedFactor = 2.0
+	DefaultIterations  = 10
+	DefaultPrecision   = 8
+
+	// geohash strings longer than 12 characters carry no extra precision
+	maxPrecision = 12
+)
+
+// Options controls the outlier filter of AdjustRoute.
+type Options struct {
+	// MaxSpeed is the highest plausible speed in metres per second.
+	MaxSpeed float64
+	// SpeedFactor scales MaxSpeed, a segment is suspicious when its
+	// distance exceeds SpeedFactor*MaxSpeed*time.
+	SpeedFactor float64
+	// Iterations caps the number of filter passes over the route, the
+	// filter stops earlier once a pass removes nothing. Zero means no cap.
+	Iterations int
+	// Precision is the geohash length used to bucket points when
+	// ClusterByGeohash is set. It is ignored otherwise.
+	Precision int
+	// ClusterByGeohash shares suspicion between all points in the same
+	// geohash cell instead of tracking it per point.
+	ClusterByGeohash bool
+	// MaxAcceleration is the highest plausible change of speed between
+	// consecutive segments in metres per second squared, zero disables the
+	// acceleration rule.
+	MaxAcceleration float64
+	// MaxJerk is the highest plausible change of acceleration in metres per
+	// second cubed, zero disables the jerk rule.
+	MaxJerk float64
+	// DropInvalid drops the points that fail ValidateLocation before the
+	// first pass, otherwise any of them fails the whole route with a
+	// ValidationError.
+	DropInvalid bool
+	// MaxAccuracy drops every fix whose horizontal accuracy in metres is
+	// known and worse than this before the first pass, zero keeps them all.
+	// Only AdjustFixes knows the accuracy.
+	MaxAccuracy float64
+	// PreferAccurate puts the suspicion of a segment only on its less
+	// accurate point when the accuracy of both points is known, which only
+	// AdjustFixes does.
+	PreferAccurate bool
+	// Spike, when set, raises suspicion on the middle point of every
+	// out-and-back spike even if no speed limit is broken.
+	Spike *SpikeOptions
+	// Datum is the datum of the input route, empty means WGS84.
+	Datum Datum
+	// OutputDatum is the datum the filtered route is returned in, empty
+	// means the datum of the input.
+	OutputDatum Datum
+	// MaxGap is the longest time in seconds between two fixes that is still
+	// checked against the speed rule, zero checks every segment.
+	MaxGap float64
+	// GapSpeed is the highest plausible average speed in metres per second
+	// across a gap longer than MaxGap, zero never flags a gap. SpeedFactor
+	// does not apply to it.
+	GapSpeed float64
+}
+
+// DefaultOptions returns the options used by AdjustedRoute.
+func DefaultOptions() Options {
+	return Options{
+		MaxSpeed:    DefaultMaxSpeed,
+		SpeedFactor: DefaultSpeedFactor,
+		Iterations:  DefaultIterations,
+		Precision:   DefaultPrecision,
+	}
+}
+
+// OptionError reports an option that has a bad value.
+type OptionError struct {
+	Field  string
+	Value  interface{}
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("adjust: invalid option %s=%v: %s", e.Field, e.Value, e.Reason)
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o Options) Validate() error {
+	if !(o.MaxSpeed > 0) || math.IsInf(o.MaxSpeed, 0) {
+		return &OptionError{"MaxSpeed", o.MaxSpeed, "must be a positive finite number"}
+	}
+	if !(o.SpeedFactor > 0) || math.IsInf(o.SpeedFactor, 0) {
+		return &OptionError{"SpeedFactor", o.SpeedFactor, "must be a positive finite number"}
+	}
+	if o.Iterations < 0 {
+		return &OptionError{"Iterations", o.Iterations, "must not be negative"}
+	}
+	if o.ClusterByGeohash && (o.Precision <= 0 || o.Precision > maxPrecision) {
+		return &OptionError{"Precision", o.Precision, fmt.Sprintf("must be between 1 and %d", maxPrecision)}
+	}
+	if o.MaxAcceleration < 0 || math.IsNaN(o.MaxAcceleration) {
+		return &OptionError{"MaxAcceleration", o.MaxAcceleration, "must not be negative"}
+	}
+	if o.MaxJerk < 0 || math.IsNaN(o.MaxJerk) {
+		return &OptionError{"MaxJerk", o.MaxJerk, "must not be negative"}
+	}
+	if o.MaxAccuracy < 0 || math.IsNaN(o.MaxAccuracy) {
+		return &OptionError{"MaxAccuracy", o.MaxAccuracy, "must not be negative"}
+	}
+	if o.Spike != nil {
+		if err := o.Spike.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Datum != "" {
+		if err := o.Datum.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.OutputDatum != "" {
+		if err := o.OutputDatum.Validate(); err != nil {
+			return &OptionError{"OutputDatum", o.OutputDatum, "is not a known datum"}
+		}
+	}
+	if o.MaxGap < 0 || math.IsNaN(o.MaxGap) {
+		return &OptionError{"MaxGap", o.MaxGap, "must not be negative"}
+	}
+	if o.GapSpeed < 0 || math.IsNaN(o.GapSpeed) {
+		return &OptionError{"GapSpeed", o.GapSpeed, "must not be negative"}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package adjust
+
+import "fmt"
+
+// Names of the built-in stages.
+const (
+	StageValidate   = "validate"
+	StageTimestamps = "timestamps"
+	StageFilter     = "filter"
+	StageKalman     = "kalman"
+	StageSimplify   = "simplify"
+	StageResample   = "resample"
+	StageFillGaps   = "fill-gaps"
+)
+
+// Annotation is a note a stage leaves about a point of its input track.
+type Annotation struct {
+	Stage string `json:"stage"`
+	// Index is the position of the point in the input of the stage.
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// Stage is one step of a Pipeline. A track is a sequence of fixes, so that
+// stages can read and keep their metadata.
+type Stage interface {
+	Name() string
+	Process(track []Fix) ([]Fix, []Annotation, error)
+}
+
+// StageError reports the stage a pipeline failed in.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("adjust: stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline runs a track through its stages in order.
+type Pipeline struct {
+	Stages []Stage
+}
+
+// NewPipeline returns a pipeline of stages.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{Stages: stages}
+}
+
+// DefaultPipeline returns the pipeline that does what AdjustedRoute does.
+func DefaultPipeline() *Pipeline {
+	return NewPipeline(FilterStage{DefaultOptions()})
+}
+
+// Run passes track through every stage and returns the output of the last
+// one along with the annotations of all of them, in stage order.
+func (p *Pipeline) Run(track []Fix) ([]Fix, []Annotation, error) {
+	var annotations []Annotation
+	for _, stage := range p.Stages {
+		out, notes, err := stage.Process(track)
+		if err != nil {
+			return []Fix{}, nil, &StageError{stage.Name(), err}
+		}
+		track = out
+		annotations = append(annotations, notes...)
+	}
+	return track, annotations, nil
+}
+
+// ValidateStage checks every point with ValidateLocation and fails on the
+// first invalid one, or drops the invalid points when Drop is set.
+type ValidateStage struct {
+	Drop bool
+}
+
+func (ValidateStage) Name() string { return StageValidate }
+
+func (s ValidateStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	if !s.Drop {
+		if err := ValidateRoute(Locations(track)); err != nil {
+			return nil, nil, err
+		}
+		return track, nil, nil
+	}
+
+	var valid []Fix
+	var annotations []Annotation
+	for i, fix := range track {
+		if err := ValidateLocation(fix.Location); err != nil {
+			annotations = append(annotations, Annotation{StageValidate, i, err.Error()})
+			continue
+		}
+		valid = append(valid, fix)
+	}
+	return valid, annotations, nil
+}
+
+// TimestampStage runs NormalizeTimestamps.
+type TimestampStage struct {
+	Policy TimestampPolicy
+}
+
+func (TimestampStage) Name() string { return StageTimestamps }
+
+func (s TimestampStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	route, sources, changes, err := normalizeTimestamps(Locations(track), s.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make([]Fix, len(route))
+	for i, loc := range route {
+		out[i] = track[sources[i]]
+		out[i].Location = loc
+	}
+	var annotations []Annotation
+	for _, i := range changes.Dropped {
+		annotations = append(annotations, Annotation{StageTimestamps, i, "dropped backwards timestamp"})
+	}
+	for _, i := range changes.Repaired {
+		annotations = append(annotations, Annotation{StageTimestamps, i, "repaired backwards timestamp"})
+	}
+	for _, run := range changes.Merged {
+		for _, i := range run[1:] {
+			annotations = append(annotations, Annotation{StageTimestamps, i, fmt.Sprintf("merged into duplicate at index %d", run[0])})
+		}
+	}
+	return out, annotations, nil
+}
+
+// FilterStage runs the outlier filter of AdjustFixes.
+type FilterStage struct {
+	Options Options
+}
+
+func (FilterStage) Name() string { return StageFilter }
+
+func (s FilterStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	out, report, err := AdjustFixesWithReport(track, s.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var annotations []Annotation
+	for _, p := range report.Points {
+		if p.Decision == DecisionDrop {
+			annotations = append(annotations, Annotation{StageFilter, p.Index, string(p.Rule)})
+		}
+	}
+	return out, annotations, nil
+}
+
+// KalmanStage runs KalmanSmoothFixes.
+type KalmanStage struct {
+	Options KalmanOptions
+}
+
+func (KalmanStage) Name() string { return StageKalman }
+
+func (s KalmanStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	out, err := KalmanSmoothFixes(track, s.Options)
+	return out, nil, err
+}
+
+// SimplifyMethod names a simplification algorithm.
+type SimplifyMethod string
+
+const (
+	SimplifyDP SimplifyMethod = "douglas-peucker"
+	SimplifyVW SimplifyMethod = "visvalingam"
+)
+
+// SimplifyStage runs SimplifyDouglasPeucker or SimplifyVisvalingam.
+type SimplifyStage struct {
+	Method    SimplifyMethod
+	Tolerance float64
+}
+
+func (SimplifyStage) Name() string { return StageSimplify }
+
+func (s SimplifyStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	var route []Location
+	var err error
+	switch s.Method {
+	case SimplifyDP, "":
+		route, err = SimplifyDouglasPeucker(Locations(track), s.Tolerance)
+	case SimplifyVW:
+		route, err = SimplifyVisvalingam(Locations(track), s.Tolerance)
+	default:
+		err = &OptionError{"Method", s.Method, "is not a known simplification"}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the output is a subsequence of the input
+	var out []Fix
+	var annotations []Annotation
+	for i, fix := range track {
+		if len(out) < len(route) && route[len(out)] == fix.Location {
+			out = append(out, fix)
+			continue
+		}
+		annotations = append(annotations, Annotation{StageSimplify, i, "simplified away"})
+	}
+	return out, annotations, nil
+}
+
+// ResampleStage runs ResampleFixes.
+type ResampleStage struct {
+	Options ResampleOptions
+}
+
+func (ResampleStage) Name() string { return StageResample }
+
+func (s ResampleStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	out, err := ResampleFixes(track, s.Options)
+	return out, nil, err
+}
+
+// FillGapsStage runs FillGapsFixes.
+type FillGapsStage struct {
+	Options GapFillOptions
+}
+
+func (FillGapsStage) Name() string { return StageFillGaps }
+
+func (s FillGapsStage) Process(track []Fix) ([]Fix, []Annotation, error) {
+	out, err := FillGapsFixes(track, s.Options)
+	return out, nil, err
+}
@@ -0,0 +1,43 @@
+package adjust
+
+import "testing"
+
+func TestPipelineKeepsMetadata(t *testing.T) {
+	raw := Fixes(straightRoute(12, 5, 1))
+	for i := range raw {
+		raw[i].Accuracy = 5
+		raw[i].Provider = ProviderGPS
+	}
+	// a duplicate of the fix before it, a fix too poor to use and a tunnel
+	raw[3].UTC = raw[2].UTC
+	raw[5].Accuracy = 100
+	for i := 8; i < len(raw); i++ {
+		raw[i].UTC += 60
+	}
+	opts := DefaultOptions()
+	opts.MaxAccuracy = 50
+
+	p := NewPipeline(
+		TimestampStage{DefaultTimestampPolicy()},
+		FilterStage{opts},
+		FillGapsStage{GapFillOptions{MaxGap: 30, Interval: 10}},
+	)
+	out, _, err := p.Run(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthetic := 0
+	for i, f := range out {
+		if f.Synthetic {
+			synthetic++
+			continue
+		}
+		if f.Accuracy != 5 || f.Provider != ProviderGPS {
+			t.Errorf("fix %d lost its metadata: %+v", i, f)
+		}
+	}
+	// 12 fixes less the duplicate and the poor one, and 6 points in the tunnel
+	if len(out) != 16 || synthetic != 6 {
+		t.Errorf("got %d fixes, %d of them synthetic, want 16 and 6", len(out), synthetic)
+	}
+}
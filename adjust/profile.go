@@ -0,0 +1,106 @@
+package adjust
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Names of the built-in transport-mode profiles.
+const (
+	ProfileWalk       = "walk"
+	ProfileBicycle    = "bicycle"
+	ProfileEBike      = "e-bike"
+	ProfileMotorcycle = "motorcycle"
+	ProfileCar        = "car"
+)
+
+// Profile describes the movement limits of a transport mode.
+type Profile struct {
+	Name string
+	// MaxSpeed is the highest plausible speed in metres per second.
+	MaxSpeed float64
+	// MaxGap is the longest time in seconds between two fixes that the
+	// speed rule still compares.
+	MaxGap float64
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		ProfileWalk:       {ProfileWalk, 3.0, 300},
+		ProfileBicycle:    {ProfileBicycle, 12.0, 180},
+		ProfileEBike:      {ProfileEBike, 15.0, 180},
+		ProfileMotorcycle: {ProfileMotorcycle, 40.0, 120},
+		ProfileCar:        {ProfileCar, 50.0, 120},
+	}
+)
+
+// Options returns DefaultOptions tuned to the profile. Gaps longer than
+// MaxGap are skipped, as GapSpeed is left at zero: the jump across a tunnel
+// or a car park is no evidence against either of its ends. The acceleration
+// rule stays off, since GPS noise alone pushes raw fix-to-fix speeds past
+// the acceleration of any vehicle.
+func (p Profile) Options() Options {
+	opts := DefaultOptions()
+	opts.MaxSpeed = p.MaxSpeed
+	opts.MaxGap = p.MaxGap
+	return opts
+}
+
+// Validate checks the profile and returns an *OptionError for the first bad value.
+func (p Profile) Validate() error {
+	if p.Name == "" {
+		return &OptionError{"Profile.Name", p.Name, "must not be empty"}
+	}
+	if !(p.MaxSpeed > 0) || math.IsInf(p.MaxSpeed, 0) {
+		return &OptionError{"Profile.MaxSpeed", p.MaxSpeed, "must be a positive finite number"}
+	}
+	if p.MaxGap < 0 || math.IsNaN(p.MaxGap) {
+		return &OptionError{"Profile.MaxGap", p.MaxGap, "must not be negative"}
+	}
+	return nil
+}
+
+// RegisterProfile adds p to the known profiles, replacing any profile with the same name.
+func RegisterProfile(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	profilesMu.Lock()
+	profiles[p.Name] = p
+	profilesMu.Unlock()
+	return nil
+}
+
+// LookupProfile returns the profile registered under name.
+func LookupProfile(name string) (Profile, error) {
+	profilesMu.RLock()
+	p, ok := profiles[name]
+	profilesMu.RUnlock()
+	if !ok {
+		return Profile{}, &OptionError{"Profile", name, "is not registered"}
+	}
+	return p, nil
+}
+
+// ProfileNames returns the names of all registered profiles in sorted order.
+func ProfileNames() []string {
+	profilesMu.RLock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	profilesMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// AdjustRouteWithProfile filters rawRoute with the options of the named profile.
+func AdjustRouteWithProfile(rawRoute []Location, name string) ([]Location, error) {
+	p, err := LookupProfile(name)
+	if err != nil {
+		return []Location{}, err
+	}
+	return AdjustRoute(rawRoute, p.Options())
+}
@@ -0,0 +1,67 @@
+package adjust
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// noisyRoute returns n fixes heading north at speed metres per second, one
+// every dt seconds, each off by normal noise of sigma metres on both axes.
+func noisyRoute(r *rand.Rand, n int, speed, dt, sigma float64) []Location {
+	route := straightRoute(n, speed, dt)
+	for i := range route {
+		route[i] = shift(route[i], r.NormFloat64()*sigma, r.NormFloat64()*sigma)
+	}
+	return route
+}
+
+func TestProfilesKeepCleanTracks(t *testing.T) {
+	tests := []struct {
+		profile string
+		speed   float64
+		dt      float64
+		sigma   float64
+	}{
+		{ProfileWalk, 1.3, 3, 2},
+		{ProfileWalk, 1.3, 5, 3},
+		{ProfileBicycle, 5, 1, 1},
+		{ProfileBicycle, 5, 5, 3},
+		{ProfileEBike, 5, 1, 1},
+		{ProfileEBike, 8, 1, 3},
+		{ProfileMotorcycle, 15, 1, 3},
+		{ProfileCar, 15, 1, 3},
+		{ProfileCar, 30, 1, 3},
+	}
+	for _, tt := range tests {
+		raw := noisyRoute(rand.New(rand.NewSource(1)), 600, tt.speed, tt.dt, tt.sigma)
+		p, err := LookupProfile(tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, report, err := AdjustRouteWithReport(raw, p.Options())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.profile, err)
+		}
+		if dropped := report.Dropped(); len(dropped) > 0 {
+			t.Errorf("%s at %v m/s every %v s with %v m noise: dropped %d of %d fixes, first by rule %q",
+				tt.profile, tt.speed, tt.dt, tt.sigma, len(dropped), len(raw), report.Points[dropped[0]].Rule)
+		}
+	}
+}
+
+func TestProfileOptions(t *testing.T) {
+	for _, name := range ProfileNames() {
+		p, err := LookupProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := p.Options()
+		if opts.MaxSpeed != p.MaxSpeed || opts.MaxGap != p.MaxGap {
+			t.Errorf("%s: MaxSpeed %v and MaxGap %v, want %v and %v", name, opts.MaxSpeed, opts.MaxGap, p.MaxSpeed, p.MaxGap)
+		}
+		// the acceleration and gap rules are opt-in
+		if opts.MaxAcceleration != 0 || opts.GapSpeed != 0 {
+			t.Errorf("%s: MaxAcceleration %v and GapSpeed %v, want both 0", name, opts.MaxAcceleration, opts.GapSpeed)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package adjust
+
+import "math"
+
+// projection maps coordinates to metres on a plane touching the earth at
+// an origin, x pointing east and y pointing north. It is accurate enough
+// for the few kilometres a route usually spans.
+type projection struct {
+	lat0, lng0 float64
+	cosLat0    float64
+}
+
+func newProjection(origin Location) projection {
+	return projection{
+		lat0:    origin.Lat,
+		lng0:    origin.Lng,
+		cosLat0: math.Cos(origin.Lat * math.Pi / 180.0),
+	}
+}
+
+func (p projection) toXY(loc Location) (x, y float64) {
+	x = (loc.Lng - p.lng0) * math.Pi / 180.0 * EarthRadius * p.cosLat0
+	y = (loc.Lat - p.lat0) * math.Pi / 180.0 * EarthRadius
+	return x, y
+}
+
+func (p projection) toLatLng(x, y float64) (lat, lng float64) {
+	lat = p.lat0 + y/EarthRadius*180.0/math.Pi
+	lng = p.lng0 + x/(EarthRadius*p.cosLat0)*180.0/math.Pi
+	return lat, lng
+}
@@ -0,0 +1,104 @@
+package adjust
+
+import "math"
+
+// Rule names the check that raised suspicion on a point.
+type Rule string
+
+const (
+	RuleNone  Rule = ""
+	RuleSpeed Rule = "speed"
+	// RuleAcceleration fires when the speed changes too fast between two segments.
+	RuleAcceleration Rule = "acceleration"
+	// RuleJerk fires when the acceleration changes too fast between two segments.
+	RuleJerk Rule = "jerk"
+	// RuleInvalid drops a point that fails ValidateLocation.
+	RuleInvalid Rule = "invalid"
+	// RuleAccuracy drops a point whose horizontal accuracy is too poor.
+	RuleAccuracy Rule = "accuracy"
+	// RuleGap fires when the jump across a gap is too far for the time elapsed.
+	RuleGap Rule = "gap"
+	// RuleSpike fires on the middle point of an out-and-back spike.
+	RuleSpike Rule = "spike"
+)
+
+// Decision tells whether a point survived the filter.
+type Decision string
+
+const (
+	DecisionKeep Decision = "keep"
+	DecisionDrop Decision = "drop"
+)
+
+// PointReport explains the outcome of the filter for one input point.
+type PointReport struct {
+	// Index is the position of the point in the input route.
+	Index    int      `json:"index"`
+	Decision Decision `json:"decision"`
+	// Iteration is the 1-based pass that dropped the point, 0 if it was
+	// kept or dropped before the first pass.
+	Iteration int `json:"iteration"`
+	// Suspicion is the suspicion count of the point summed over all passes.
+	Suspicion int `json:"suspicion"`
+	// Speed, Distance and Duration describe the fastest neighbouring segment
+	// seen by the filter. Speed is 0 when Duration is not positive.
+	Speed    float64 `json:"speed"`
+	Distance float64 `json:"distance"`
+	Duration float64 `json:"duration"`
+	// Rule is the rule that fired on the point in the last pass that raised
+	// its suspicion, which for a dropped point is the pass that dropped it.
+	// It is RuleNone for a point no rule fired on.
+	Rule Rule `json:"rule"`
+}
+
+// Report explains the outcome of the filter for a whole route.
+type Report struct {
+	// Iterations is the number of passes that ran.
+	Iterations int `json:"iterations"`
+	// Converged is set when the last pass removed nothing, so the route
+	// would not change with more passes.
+	Converged bool          `json:"converged"`
+	Points    []PointReport `json:"points"`
+}
+
+// Dropped returns the input indices of the dropped points.
+func (r *Report) Dropped() []int {
+	var indices []int
+	for _, p := range r.Points {
+		if p.Decision == DecisionDrop {
+			indices = append(indices, p.Index)
+		}
+	}
+	return indices
+}
+
+func newReport(n int) *Report {
+	report := &Report{Points: make([]PointReport, n)}
+	for i := range report.Points {
+		report.Points[i] = PointReport{Index: i, Decision: DecisionKeep}
+	}
+	return report
+}
+
+// observeSegment records a segment next to the point if it is the fastest one seen so far.
+func (p *PointReport) observeSegment(distance, duration float64) {
+	if p.Distance == 0 && p.Duration == 0 || impliedSpeed(distance, duration) > impliedSpeed(p.Distance, p.Duration) {
+		p.Distance = distance
+		p.Duration = duration
+		p.Speed = 0
+		if duration > 0 {
+			p.Speed = distance / duration
+		}
+	}
+}
+
+// impliedSpeed returns distance/duration, treating any movement in no time as infinitely fast.
+func impliedSpeed(distance, duration float64) float64 {
+	if duration <= 0 {
+		if distance > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return distance / duration
+}
@@ -0,0 +1,128 @@
+package adjust
+
+import "math"
+
+// ResampleOptions controls Resample.
+type ResampleOptions struct {
+	// Interval is the time in seconds between two output points.
+	Interval float64
+	// MaxGap is the longest time in seconds between two fixes that points
+	// are interpolated across, zero interpolates across any gap.
+	MaxGap float64
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o ResampleOptions) Validate() error {
+	if !(o.Interval > 0) || math.IsInf(o.Interval, 0) {
+		return &OptionError{"Interval", o.Interval, "must be a positive finite number"}
+	}
+	if o.MaxGap < 0 || math.IsNaN(o.MaxGap) {
+		return &OptionError{"MaxGap", o.MaxGap, "must not be negative"}
+	}
+	return nil
+}
+
+// interpolate returns the point a fraction f of the way from a to b along
+// the great circle through them.
+func interpolate(a, b Location, f float64) Location {
+	if f == 0 {
+		return a
+	}
+	if f == 1 {
+		return b
+	}
+	loc := Location{Lat: a.Lat, Lng: a.Lng, UTC: a.UTC + f*(b.UTC-a.UTC)}
+	delta := getDistance(a, b) / EarthRadius
+	if delta == 0 {
+		return loc
+	}
+	radians := func(val float64) float64 {
+		return math.Pi * val / 180.0
+	}
+	lat1, lng1 := radians(a.Lat), radians(a.Lng)
+	lat2, lng2 := radians(b.Lat), radians(b.Lng)
+	wa := math.Sin((1-f)*delta) / math.Sin(delta)
+	wb := math.Sin(f*delta) / math.Sin(delta)
+	x := wa*math.Cos(lat1)*math.Cos(lng1) + wb*math.Cos(lat2)*math.Cos(lng2)
+	y := wa*math.Cos(lat1)*math.Sin(lng1) + wb*math.Cos(lat2)*math.Sin(lng2)
+	z := wa*math.Sin(lat1) + wb*math.Sin(lat2)
+	loc.Lat = math.Atan2(z, math.Sqrt(x*x+y*y)) * 180.0 / math.Pi
+	loc.Lng = math.Atan2(y, x) * 180.0 / math.Pi
+	return loc
+}
+
+// interpolateFix is interpolate for fixes. The metadata is copied from the
+// nearer of the two, the elevation is interpolated when both know it and
+// the point is marked synthetic unless it is a or b.
+func interpolateFix(a, b Fix, f float64) Fix {
+	fix := a
+	if f > 0.5 {
+		fix = b
+	}
+	if f == 0 || f == 1 {
+		return fix
+	}
+	fix.Location = interpolate(a.Location, b.Location, f)
+	fix.Synthetic = true
+	if a.Elevation != 0 && b.Elevation != 0 {
+		fix.Elevation = a.Elevation + f*(b.Elevation-a.Elevation)
+	}
+	return fix
+}
+
+// Resample returns route at fixed steps of opts.Interval seconds from its
+// first fix, interpolating along great circles between neighbouring fixes.
+// No point is made up inside a gap longer than opts.MaxGap, and an interval
+// longer than the spacing of the fixes thins the route out. route must be
+// in time order.
+func Resample(route []Location, opts ResampleOptions) ([]Location, error) {
+	fixes, err := ResampleFixes(Fixes(route), opts)
+	if err != nil {
+		return []Location{}, err
+	}
+	return Locations(fixes), nil
+}
+
+// ResampleFixes is like Resample but marks the points it makes up as
+// Synthetic, with the metadata of the nearer fix.
+func ResampleFixes(route []Fix, opts ResampleOptions) ([]Fix, error) {
+	if err := opts.Validate(); err != nil {
+		return []Fix{}, err
+	}
+	for i := 1; i < len(route); i++ {
+		if route[i].UTC < route[i-1].UTC {
+			return []Fix{}, &TimestampError{i, route[i].UTC, route[i-1].UTC}
+		}
+	}
+	if len(route) == 0 {
+		return []Fix{}, nil
+	}
+
+	var resampled []Fix
+	first, last := route[0].UTC, route[len(route)-1].UTC
+	i := 0
+	for step := 0; ; step++ {
+		t := first + float64(step)*opts.Interval
+		if t > last {
+			break
+		}
+		// find the segment route[i]-route[i+1] around t
+		for i < len(route)-1 && route[i+1].UTC < t {
+			i++
+		}
+		if i == len(route)-1 || route[i].UTC == t {
+			resampled = append(resampled, route[i])
+			continue
+		}
+		a, b := route[i], route[i+1]
+		if t == b.UTC {
+			resampled = append(resampled, b)
+			continue
+		}
+		if opts.MaxGap > 0 && b.UTC-a.UTC > opts.MaxGap {
+			continue
+		}
+		resampled = append(resampled, interpolateFix(a, b, (t-a.UTC)/(b.UTC-a.UTC)))
+	}
+	return resampled, nil
+}
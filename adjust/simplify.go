@@ -0,0 +1,161 @@
+package adjust
+
+import (
+	"container/heap"
+	"math"
+)
+
+func validateTolerance(tolerance float64) error {
+	if tolerance < 0 || math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+		return &OptionError{"tolerance", tolerance, "must be a finite number not below zero"}
+	}
+	return nil
+}
+
+// segmentDistance returns the distance in metres from p to the segment a-b.
+func segmentDistance(p, a, b Location) float64 {
+	proj := newProjection(a)
+	px, py := proj.toXY(p)
+	bx, by := proj.toXY(b)
+	length := bx*bx + by*by
+	if length == 0 {
+		return math.Hypot(px, py)
+	}
+	t := (px*bx + py*by) / length
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// triangleArea returns the area in square metres of the triangle a-b-c.
+func triangleArea(a, b, c Location) float64 {
+	proj := newProjection(b)
+	ax, ay := proj.toXY(a)
+	cx, cy := proj.toXY(c)
+	return math.Abs(ax*cy-ay*cx) / 2.0
+}
+
+// SimplifyDouglasPeucker drops the points of route that lie closer than
+// tolerance metres to the simplified line. The first and the last point are
+// always kept and every kept point keeps its timestamp.
+func SimplifyDouglasPeucker(route []Location, tolerance float64) ([]Location, error) {
+	if err := validateTolerance(tolerance); err != nil {
+		return []Location{}, err
+	}
+	if len(route) < 3 {
+		return append([]Location{}, route...), nil
+	}
+
+	keep := make([]bool, len(route))
+	keep[0], keep[len(route)-1] = true, true
+	stack := [][2]int{{0, len(route) - 1}}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		farthest, maxDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(route[i], route[first], route[last]); d > maxDistance {
+				farthest, maxDistance = i, d
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	var simplified []Location
+	for i, ok := range keep {
+		if ok {
+			simplified = append(simplified, route[i])
+		}
+	}
+	return simplified, nil
+}
+
+// vwPoint is a point of a route being simplified by SimplifyVisvalingam.
+type vwPoint struct {
+	index      int
+	area       float64
+	prev, next int
+	heapIndex  int
+}
+
+type vwHeap []*vwPoint
+
+func (h vwHeap) Len() int           { return len(h) }
+func (h vwHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vwHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *vwHeap) Push(x interface{}) {
+	p := x.(*vwPoint)
+	p.heapIndex = len(*h)
+	*h = append(*h, p)
+}
+
+func (h *vwHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// SimplifyVisvalingam repeatedly drops the point of route that forms the
+// smallest triangle with its neighbours, until every remaining triangle has
+// an area of at least tolerance² square metres. The first and the last point
+// are always kept and every kept point keeps its timestamp.
+func SimplifyVisvalingam(route []Location, tolerance float64) ([]Location, error) {
+	if err := validateTolerance(tolerance); err != nil {
+		return []Location{}, err
+	}
+	n := len(route)
+	if n < 3 {
+		return append([]Location{}, route...), nil
+	}
+
+	points := make([]vwPoint, n)
+	h := make(vwHeap, 0, n-2)
+	for i := range points {
+		points[i] = vwPoint{index: i, prev: i - 1, next: i + 1, heapIndex: -1}
+		if i > 0 && i < n-1 {
+			points[i].area = triangleArea(route[i-1], route[i], route[i+1])
+			heap.Push(&h, &points[i])
+		}
+	}
+
+	minArea := tolerance * tolerance
+	removed := make([]bool, n)
+	for h.Len() > 0 && h[0].area < minArea {
+		p := heap.Pop(&h).(*vwPoint)
+		removed[p.index] = true
+		points[p.prev].next = p.next
+		points[p.next].prev = p.prev
+
+		// a neighbour never gets a smaller area than the point removed
+		// before it, so the removal order stays monotonic
+		for _, i := range []int{p.prev, p.next} {
+			q := &points[i]
+			if q.prev < 0 || q.next >= n {
+				continue
+			}
+			q.area = math.Max(triangleArea(route[q.prev], route[i], route[q.next]), p.area)
+			heap.Fix(&h, q.heapIndex)
+		}
+	}
+
+	var simplified []Location
+	for i, loc := range route {
+		if !removed[i] {
+			simplified = append(simplified, loc)
+		}
+	}
+	return simplified, nil
+}
@@ -0,0 +1,96 @@
+package adjust
+
+import "math"
+
+const (
+	DefaultSpikeTurn     = 150.0
+	DefaultSpikeRatio    = 3.0
+	DefaultSpikeDistance = 50.0
+)
+
+// SpikeOptions describes an out-and-back spike A→B→A across three
+// consecutive points A, B, C.
+type SpikeOptions struct {
+	// MinTurn is the smallest change of heading at B in degrees.
+	MinTurn float64
+	// MinRatio is the smallest ratio of the way A→B→C over the direct
+	// distance A→C.
+	MinRatio float64
+	// MinDistance is the smallest distance in metres of B from both A and C.
+	MinDistance float64
+}
+
+// DefaultSpikeOptions returns options that catch the typical sideways jump of phone GPS.
+func DefaultSpikeOptions() SpikeOptions {
+	return SpikeOptions{
+		MinTurn:     DefaultSpikeTurn,
+		MinRatio:    DefaultSpikeRatio,
+		MinDistance: DefaultSpikeDistance,
+	}
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o SpikeOptions) Validate() error {
+	if o.MinTurn < 0 || o.MinTurn > 180 || math.IsNaN(o.MinTurn) {
+		return &OptionError{"Spike.MinTurn", o.MinTurn, "must be between 0 and 180"}
+	}
+	if o.MinRatio < 1 || math.IsNaN(o.MinRatio) {
+		return &OptionError{"Spike.MinRatio", o.MinRatio, "must be at least 1"}
+	}
+	if o.MinDistance < 0 || math.IsNaN(o.MinDistance) {
+		return &OptionError{"Spike.MinDistance", o.MinDistance, "must not be negative"}
+	}
+	return nil
+}
+
+// getBearing returns the initial bearing from loc to loc2 in degrees clockwise from north.
+func getBearing(loc, loc2 Location) float64 {
+	radians := func(val float64) float64 {
+		return math.Pi * val / 180.0
+	}
+
+	lat1, lat2 := radians(loc.Lat), radians(loc2.Lat)
+	lngDiff := radians(loc2.Lng - loc.Lng)
+	y := math.Sin(lngDiff) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(lngDiff)
+	return math.Mod(math.Atan2(y, x)*180.0/math.Pi+360.0, 360.0)
+}
+
+// turnAngle returns the change of heading at b in degrees between 0 and 180.
+func turnAngle(a, b, c Location) float64 {
+	turn := math.Abs(getBearing(b, c) - getBearing(a, b))
+	if turn > 180 {
+		turn = 360 - turn
+	}
+	return turn
+}
+
+// isSpike tells whether b is a spike between a and c, ab and bc being the
+// distances from a to b and from b to c.
+func (o SpikeOptions) isSpike(a, b, c Location, ab, bc float64) bool {
+	if ab < o.MinDistance || bc < o.MinDistance || ab == 0 || bc == 0 {
+		return false
+	}
+	if turnAngle(a, b, c) < o.MinTurn {
+		return false
+	}
+	return ab+bc >= o.MinRatio*getDistance(a, c)
+}
+
+// DetectSpikes returns the indices of the points of route that shoot out
+// and come straight back, regardless of their speed.
+func DetectSpikes(route []Location, opts SpikeOptions) ([]int, error) {
+	if err := opts.Validate(); err != nil {
+		return []int{}, err
+	}
+
+	var spikes []int
+	for i := 1; i < len(route)-1; i++ {
+		ab := getDistance(route[i-1], route[i])
+		bc := getDistance(route[i], route[i+1])
+		if opts.isSpike(route[i-1], route[i], route[i+1], ab, bc) {
+			spikes = append(spikes, i)
+		}
+	}
+	return spikes, nil
+}
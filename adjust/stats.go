@@ -0,0 +1,122 @@
+package adjust
+
+import "math"
+
+const DefaultIdleSpeed = 0.5
+
+// StatsOptions controls how Stats tells moving from idle time.
+type StatsOptions struct {
+	// IdleSpeed is the speed in metres per second at or below which a
+	// segment counts as idle.
+	IdleSpeed float64
+	// MaxGap is the longest time in seconds a segment may take and still
+	// count as moving, longer segments are idle. Zero disables the check.
+	MaxGap float64
+}
+
+// DefaultStatsOptions returns options that treat walking pace and faster as moving.
+func DefaultStatsOptions() StatsOptions {
+	return StatsOptions{IdleSpeed: DefaultIdleSpeed}
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o StatsOptions) Validate() error {
+	if o.IdleSpeed < 0 || math.IsNaN(o.IdleSpeed) || math.IsInf(o.IdleSpeed, 0) {
+		return &OptionError{"IdleSpeed", o.IdleSpeed, "must be a finite number not below zero"}
+	}
+	if o.MaxGap < 0 || math.IsNaN(o.MaxGap) {
+		return &OptionError{"MaxGap", o.MaxGap, "must not be negative"}
+	}
+	return nil
+}
+
+// RouteStats sums up a route. Distances are in metres, times in seconds
+// and speeds in metres per second.
+type RouteStats struct {
+	Points   int     `json:"points"`
+	Distance float64 `json:"distance"`
+	// Duration is the time between the first and the last point.
+	Duration   float64 `json:"duration"`
+	MovingTime float64 `json:"moving_time"`
+	IdleTime   float64 `json:"idle_time"`
+	// AvgSpeed is Distance over Duration, MovingSpeed is Distance over MovingTime.
+	AvgSpeed    float64 `json:"avg_speed"`
+	MovingSpeed float64 `json:"moving_speed"`
+	MaxSpeed    float64 `json:"max_speed"`
+}
+
+// Stats sums up route, which is expected in time order.
+func Stats(route []Location, opts StatsOptions) (RouteStats, error) {
+	if err := opts.Validate(); err != nil {
+		return RouteStats{}, err
+	}
+
+	stats := RouteStats{Points: len(route)}
+	for i := 0; i < len(route)-1; i++ {
+		distance := getDistance(route[i], route[i+1])
+		time := route[i+1].UTC - route[i].UTC
+		stats.Distance += distance
+		if time <= 0 {
+			continue
+		}
+		speed := distance / time
+		if speed > opts.IdleSpeed && !(opts.MaxGap > 0 && time > opts.MaxGap) {
+			stats.MovingTime += time
+			stats.MaxSpeed = math.Max(stats.MaxSpeed, speed)
+		} else {
+			stats.IdleTime += time
+		}
+	}
+	if len(route) > 1 {
+		stats.Duration = route[len(route)-1].UTC - route[0].UTC
+	}
+	if stats.Duration > 0 {
+		stats.AvgSpeed = stats.Distance / stats.Duration
+	}
+	if stats.MovingTime > 0 {
+		stats.MovingSpeed = stats.Distance / stats.MovingTime
+	}
+	return stats, nil
+}
+
+// StatsComparison sums up a route before and after filtering.
+type StatsComparison struct {
+	Before RouteStats `json:"before"`
+	After  RouteStats `json:"after"`
+	// Removed is the number of points the filter dropped.
+	Removed int `json:"removed"`
+	// DistanceRemoved is the distance the dropped points added to the route.
+	DistanceRemoved float64 `json:"distance_removed"`
+}
+
+// CompareStats sums up rawRoute and filtered, the result of filtering it.
+func CompareStats(rawRoute, filtered []Location, opts StatsOptions) (StatsComparison, error) {
+	before, err := Stats(rawRoute, opts)
+	if err != nil {
+		return StatsComparison{}, err
+	}
+	after, err := Stats(filtered, opts)
+	if err != nil {
+		return StatsComparison{}, err
+	}
+	return StatsComparison{
+		Before:          before,
+		After:           after,
+		Removed:         before.Points - after.Points,
+		DistanceRemoved: before.Distance - after.Distance,
+	}, nil
+}
+
+// AdjustRouteWithStats is like AdjustRoute but also compares the route
+// before and after filtering.
+func AdjustRouteWithStats(rawRoute []Location, opts Options, statsOpts StatsOptions) ([]Location, StatsComparison, error) {
+	if err := statsOpts.Validate(); err != nil {
+		return []Location{}, StatsComparison{}, err
+	}
+	route, err := AdjustRoute(rawRoute, opts)
+	if err != nil {
+		return []Location{}, StatsComparison{}, err
+	}
+	comparison, err := CompareStats(rawRoute, route, statsOpts)
+	return route, comparison, err
+}
@@ -0,0 +1,90 @@
+package adjust
+
+import "math"
+
+const (
+	DefaultStayDistance = 100.0
+	DefaultStayDuration = 120.0
+)
+
+// StayOptions controls the stay-point detection of DetectStayPoints.
+type StayOptions struct {
+	// MaxDistance is the radius in metres around the first point of a stay
+	// that the following points must remain within.
+	MaxDistance float64
+	// MinDuration is the shortest time in seconds that counts as a stay.
+	MinDuration float64
+}
+
+// DefaultStayOptions returns a setting suitable for delivery stops.
+func DefaultStayOptions() StayOptions {
+	return StayOptions{
+		MaxDistance: DefaultStayDistance,
+		MinDuration: DefaultStayDuration,
+	}
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o StayOptions) Validate() error {
+	if !(o.MaxDistance > 0) || math.IsInf(o.MaxDistance, 0) {
+		return &OptionError{"MaxDistance", o.MaxDistance, "must be a positive finite number"}
+	}
+	if o.MinDuration < 0 || math.IsNaN(o.MinDuration) || math.IsInf(o.MinDuration, 0) {
+		return &OptionError{"MinDuration", o.MinDuration, "must be a finite number not below zero"}
+	}
+	return nil
+}
+
+// StayPoint is a place where the route lingered.
+type StayPoint struct {
+	// Lat and Lng are the centroid of the member points.
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Arrival   float64 `json:"arrival"`
+	Departure float64 `json:"departure"`
+	Duration  float64 `json:"duration"`
+	// Indices are the positions of the member points in the route.
+	Indices []int `json:"indices"`
+}
+
+// DetectStayPoints finds the stretches of route that stay within
+// opts.MaxDistance of their first point for at least opts.MinDuration.
+// route is expected in time order, as returned by AdjustRoute.
+func DetectStayPoints(route []Location, opts StayOptions) ([]StayPoint, error) {
+	if err := opts.Validate(); err != nil {
+		return []StayPoint{}, err
+	}
+
+	var stays []StayPoint
+	for i := 0; i < len(route); {
+		j := i + 1
+		for j < len(route) && getDistance(route[i], route[j]) <= opts.MaxDistance {
+			j++
+		}
+		if duration := route[j-1].UTC - route[i].UTC; j-i > 1 && duration >= opts.MinDuration {
+			stays = append(stays, newStayPoint(route, i, j))
+			i = j
+		} else {
+			i++
+		}
+	}
+	return stays, nil
+}
+
+// newStayPoint builds the stay point made of route[first:end].
+func newStayPoint(route []Location, first, end int) StayPoint {
+	stay := StayPoint{
+		Arrival:   route[first].UTC,
+		Departure: route[end-1].UTC,
+		Duration:  route[end-1].UTC - route[first].UTC,
+		Indices:   make([]int, 0, end-first),
+	}
+	for i := first; i < end; i++ {
+		stay.Lat += route[i].Lat
+		stay.Lng += route[i].Lng
+		stay.Indices = append(stay.Indices, i)
+	}
+	stay.Lat /= float64(end - first)
+	stay.Lng /= float64(end - first)
+	return stay
+}
@@ -0,0 +1,180 @@
+package adjust
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BackwardsPolicy tells NormalizeTimestamps what to do with a fix that is
+// older than the fix before it.
+type BackwardsPolicy string
+
+const (
+	// BackwardsKeep leaves the fix as it is.
+	BackwardsKeep BackwardsPolicy = "keep"
+	// BackwardsReject fails with a *TimestampError.
+	BackwardsReject BackwardsPolicy = "reject"
+	// BackwardsDrop removes the fix.
+	BackwardsDrop BackwardsPolicy = "drop"
+	// BackwardsRepair moves the timestamp of the fix forward to the one
+	// before it, turning it into a duplicate.
+	BackwardsRepair BackwardsPolicy = "repair"
+)
+
+// DuplicatePolicy tells NormalizeTimestamps what to do with consecutive
+// fixes that share a timestamp.
+type DuplicatePolicy string
+
+const (
+	// DuplicatesKeep leaves all of them.
+	DuplicatesKeep DuplicatePolicy = "keep"
+	// DuplicatesFirst keeps the first of them.
+	DuplicatesFirst DuplicatePolicy = "first"
+	// DuplicatesMerge replaces them with the first one moved to their centroid.
+	DuplicatesMerge DuplicatePolicy = "merge"
+)
+
+// TimestampPolicy controls NormalizeTimestamps.
+type TimestampPolicy struct {
+	// Sort orders the fixes by UTC first, so no fix goes backwards.
+	Sort       bool
+	Backwards  BackwardsPolicy
+	Duplicates DuplicatePolicy
+}
+
+// DefaultTimestampPolicy sorts the fixes and merges duplicates.
+func DefaultTimestampPolicy() TimestampPolicy {
+	return TimestampPolicy{
+		Sort:       true,
+		Backwards:  BackwardsReject,
+		Duplicates: DuplicatesMerge,
+	}
+}
+
+// Validate checks the policy and returns an *OptionError for the first bad value.
+func (p TimestampPolicy) Validate() error {
+	switch p.Backwards {
+	case BackwardsKeep, BackwardsReject, BackwardsDrop, BackwardsRepair:
+	default:
+		return &OptionError{"Backwards", p.Backwards, "is not a known policy"}
+	}
+	switch p.Duplicates {
+	case DuplicatesKeep, DuplicatesFirst, DuplicatesMerge:
+	default:
+		return &OptionError{"Duplicates", p.Duplicates, "is not a known policy"}
+	}
+	return nil
+}
+
+// TimestampError reports a fix that is older than the fix before it.
+type TimestampError struct {
+	Index    int
+	UTC      float64
+	Previous float64
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("adjust: timestamp %v at index %d is before the previous one %v", e.UTC, e.Index, e.Previous)
+}
+
+// TimestampChanges lists what NormalizeTimestamps changed, by input index.
+type TimestampChanges struct {
+	// Sorted is set when sorting changed the order of the fixes.
+	Sorted bool `json:"sorted"`
+	// Dropped holds the fixes that were removed for going backwards.
+	Dropped []int `json:"dropped"`
+	// Repaired holds the fixes whose timestamp was moved forward.
+	Repaired []int `json:"repaired"`
+	// Merged holds every run of duplicates that became a single fix.
+	Merged [][]int `json:"merged"`
+}
+
+// Changed tells whether anything was changed at all.
+func (c *TimestampChanges) Changed() bool {
+	return c.Sorted || len(c.Dropped) > 0 || len(c.Repaired) > 0 || len(c.Merged) > 0
+}
+
+// NormalizeTimestamps prepares route for the filter, which needs strictly
+// increasing timestamps to derive speeds: it sorts, handles fixes that go
+// backwards and collapses duplicate timestamps as the policy says.
+func NormalizeTimestamps(route []Location, policy TimestampPolicy) ([]Location, *TimestampChanges, error) {
+	normalized, _, changes, err := normalizeTimestamps(route, policy)
+	return normalized, changes, err
+}
+
+// normalizeTimestamps is NormalizeTimestamps that also returns the input
+// index every output fix comes from, the first of its run of duplicates
+// when they were merged.
+func normalizeTimestamps(route []Location, policy TimestampPolicy) ([]Location, []int, *TimestampChanges, error) {
+	if err := policy.Validate(); err != nil {
+		return []Location{}, nil, nil, err
+	}
+
+	changes := &TimestampChanges{}
+	// order holds the input index of every fix of the working route
+	order := make([]int, len(route))
+	for i := range order {
+		order[i] = i
+	}
+	if policy.Sort {
+		sort.SliceStable(order, func(i, j int) bool {
+			return route[order[i]].UTC < route[order[j]].UTC
+		})
+		for i, index := range order {
+			if i != index {
+				changes.Sorted = true
+				break
+			}
+		}
+	}
+
+	var kept []Location
+	var keptOrder []int
+	for _, index := range order {
+		loc := route[index]
+		if n := len(kept); n > 0 && loc.UTC < kept[n-1].UTC {
+			switch policy.Backwards {
+			case BackwardsReject:
+				return []Location{}, nil, nil, &TimestampError{index, loc.UTC, kept[n-1].UTC}
+			case BackwardsDrop:
+				changes.Dropped = append(changes.Dropped, index)
+				continue
+			case BackwardsRepair:
+				loc.UTC = kept[n-1].UTC
+				changes.Repaired = append(changes.Repaired, index)
+			}
+		}
+		kept = append(kept, loc)
+		keptOrder = append(keptOrder, index)
+	}
+
+	if policy.Duplicates == DuplicatesKeep {
+		return kept, keptOrder, changes, nil
+	}
+
+	var normalized []Location
+	var sources []int
+	for i := 0; i < len(kept); {
+		j := i + 1
+		for j < len(kept) && kept[j].UTC == kept[i].UTC {
+			j++
+		}
+		loc := kept[i]
+		if j-i > 1 {
+			changes.Merged = append(changes.Merged, append([]int{}, keptOrder[i:j]...))
+			if policy.Duplicates == DuplicatesMerge {
+				loc.Lat, loc.Lng = 0, 0
+				for _, dup := range kept[i:j] {
+					loc.Lat += dup.Lat
+					loc.Lng += dup.Lng
+				}
+				loc.Lat /= float64(j - i)
+				loc.Lng /= float64(j - i)
+			}
+		}
+		normalized = append(normalized, loc)
+		sources = append(sources, keptOrder[i])
+		i = j
+	}
+	return normalized, sources, changes, nil
+}
@@ -0,0 +1,156 @@
+package adjust
+
+import "math"
+
+const (
+	DefaultTripGap  = 600.0
+	DefaultTripJump = 2000.0
+)
+
+// TripOptions controls how SplitTrips cuts a track into trips.
+type TripOptions struct {
+	// MaxGap is the longest time in seconds between two fixes of the same
+	// trip, zero disables splitting on time gaps.
+	MaxGap float64
+	// MaxJump is the longest distance in metres between two fixes of the
+	// same trip, zero disables splitting on distance jumps.
+	MaxJump float64
+	// SplitAtStays ends a trip when a stay point begins and starts the next
+	// one when it ends, the points inside the stay belong to no trip.
+	SplitAtStays bool
+	Stay         StayOptions
+	// Filter, when set, runs AdjustRoute over every trip.
+	Filter *Options
+}
+
+// DefaultTripOptions returns options that split on gaps, jumps and stops
+// and filter every trip with DefaultOptions.
+func DefaultTripOptions() TripOptions {
+	filter := DefaultOptions()
+	return TripOptions{
+		MaxGap:       DefaultTripGap,
+		MaxJump:      DefaultTripJump,
+		SplitAtStays: true,
+		Stay:         DefaultStayOptions(),
+		Filter:       &filter,
+	}
+}
+
+// Validate checks the options and returns an *OptionError for the first bad value.
+func (o TripOptions) Validate() error {
+	if o.MaxGap < 0 || math.IsNaN(o.MaxGap) {
+		return &OptionError{"MaxGap", o.MaxGap, "must not be negative"}
+	}
+	if o.MaxJump < 0 || math.IsNaN(o.MaxJump) {
+		return &OptionError{"MaxJump", o.MaxJump, "must not be negative"}
+	}
+	if o.SplitAtStays {
+		if err := o.Stay.Validate(); err != nil {
+			return err
+		}
+	}
+	if o.Filter != nil {
+		return o.Filter.Validate()
+	}
+	return nil
+}
+
+// TripBoundary tells why a trip starts or ends.
+type TripBoundary string
+
+const (
+	BoundaryRouteStart TripBoundary = "route-start"
+	BoundaryRouteEnd   TripBoundary = "route-end"
+	BoundaryGap        TripBoundary = "gap"
+	BoundaryJump       TripBoundary = "jump"
+	BoundaryStay       TripBoundary = "stay"
+)
+
+// Trip is a continuous part of a track.
+type Trip struct {
+	// Start and End delimit the trip in the input track, End is exclusive.
+	Start       int          `json:"start"`
+	End         int          `json:"end"`
+	StartUTC    float64      `json:"start_utc"`
+	EndUTC      float64      `json:"end_utc"`
+	StartReason TripBoundary `json:"start_reason"`
+	EndReason   TripBoundary `json:"end_reason"`
+	// Route holds the points of the trip, filtered when TripOptions.Filter is set.
+	Route []Location `json:"route"`
+}
+
+// SplitTrips cuts route into trips on time gaps, distance jumps and stay
+// points. Trips of fewer than two points are dropped.
+func SplitTrips(route []Location, opts TripOptions) ([]Trip, error) {
+	if err := opts.Validate(); err != nil {
+		return []Trip{}, err
+	}
+
+	// stayEnds maps the first index of every stay to its last index
+	stayEnds := make(map[int]int)
+	if opts.SplitAtStays {
+		stays, err := DetectStayPoints(route, opts.Stay)
+		if err != nil {
+			return []Trip{}, err
+		}
+		for _, stay := range stays {
+			stayEnds[stay.Indices[0]] = stay.Indices[len(stay.Indices)-1]
+		}
+	}
+
+	var trips []Trip
+	closeTrip := func(start, end int, startReason, endReason TripBoundary) error {
+		if end-start < 2 {
+			return nil
+		}
+		trip := Trip{
+			Start:       start,
+			End:         end,
+			StartUTC:    route[start].UTC,
+			EndUTC:      route[end-1].UTC,
+			StartReason: startReason,
+			EndReason:   endReason,
+			Route:       append([]Location{}, route[start:end]...),
+		}
+		if opts.Filter != nil {
+			filtered, err := AdjustRoute(trip.Route, *opts.Filter)
+			if err != nil {
+				return err
+			}
+			trip.Route = filtered
+		}
+		trips = append(trips, trip)
+		return nil
+	}
+
+	start, startReason := 0, BoundaryRouteStart
+	for i := 0; i < len(route); i++ {
+		if last, ok := stayEnds[i]; ok {
+			if err := closeTrip(start, i+1, startReason, BoundaryStay); err != nil {
+				return []Trip{}, err
+			}
+			start, startReason = last, BoundaryStay
+			i = last
+		}
+		if i+1 >= len(route) {
+			break
+		}
+
+		reason := TripBoundary("")
+		if opts.MaxGap > 0 && route[i+1].UTC-route[i].UTC > opts.MaxGap {
+			reason = BoundaryGap
+		} else if opts.MaxJump > 0 && getDistance(route[i], route[i+1]) > opts.MaxJump {
+			reason = BoundaryJump
+		}
+		if reason != "" {
+			if err := closeTrip(start, i+1, startReason, reason); err != nil {
+				return []Trip{}, err
+			}
+			start, startReason = i+1, reason
+		}
+	}
+	if err := closeTrip(start, len(route), startReason, BoundaryRouteEnd); err != nil {
+		return []Trip{}, err
+	}
+	return trips, nil
+}
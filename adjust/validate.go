@@ -0,0 +1,86 @@
+package adjust
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Errors returned by ValidateLocation, wrapped in a *LocationError by ValidateRoute.
+var (
+	ErrNotFinite      = errors.New("adjust: value is not a finite number")
+	ErrLatitudeRange  = errors.New("adjust: latitude out of range")
+	ErrLongitudeRange = errors.New("adjust: longitude out of range")
+	ErrSwappedLatLng  = errors.New("adjust: latitude and longitude look swapped")
+	ErrNullIsland     = errors.New("adjust: location at (0, 0)")
+)
+
+// LocationError reports an invalid location of a route.
+type LocationError struct {
+	Index int
+	Err   error
+}
+
+func (e *LocationError) Error() string {
+	return fmt.Sprintf("%v at index %d", e.Err, e.Index)
+}
+
+func (e *LocationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError collects every invalid location of a route.
+type ValidationError []*LocationError
+
+func (e ValidationError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more invalid locations)", e[0], len(e)-1)
+}
+
+// Unwrap lets errors.Is and errors.As look at every invalid location.
+func (e ValidationError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ValidateLocation returns one of the Err values when loc cannot be a real fix.
+func ValidateLocation(loc Location) error {
+	if math.IsNaN(loc.Lat) || math.IsInf(loc.Lat, 0) ||
+		math.IsNaN(loc.Lng) || math.IsInf(loc.Lng, 0) ||
+		math.IsNaN(loc.UTC) || math.IsInf(loc.UTC, 0) {
+		return ErrNotFinite
+	}
+	if math.Abs(loc.Lat) > 90 {
+		if math.Abs(loc.Lng) <= 90 {
+			return ErrSwappedLatLng
+		}
+		return ErrLatitudeRange
+	}
+	if math.Abs(loc.Lng) > 180 {
+		return ErrLongitudeRange
+	}
+	if loc.Lat == 0 && loc.Lng == 0 {
+		return ErrNullIsland
+	}
+	return nil
+}
+
+// ValidateRoute checks every location of route and returns a
+// ValidationError listing the invalid ones, or nil.
+func ValidateRoute(route []Location) error {
+	var errs ValidationError
+	for i, loc := range route {
+		if err := ValidateLocation(loc); err != nil {
+			errs = append(errs, &LocationError{i, err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
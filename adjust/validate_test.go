@@ -0,0 +1,56 @@
+package adjust
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidateLocation(t *testing.T) {
+	tests := []struct {
+		loc  Location
+		want error
+	}{
+		{Location{Lat: 31.2, Lng: 121.4, UTC: 1}, nil},
+		{Location{Lat: math.NaN(), Lng: 121.4}, ErrNotFinite},
+		{Location{Lat: 31.2, Lng: math.Inf(1)}, ErrNotFinite},
+		{Location{Lat: 31.2, Lng: 121.4, UTC: math.NaN()}, ErrNotFinite},
+		{Location{Lat: 121.4, Lng: 31.2}, ErrSwappedLatLng},
+		{Location{Lat: 121.4, Lng: 131.2}, ErrLatitudeRange},
+		{Location{Lat: 31.2, Lng: 181}, ErrLongitudeRange},
+		{Location{}, ErrNullIsland},
+	}
+	for _, tt := range tests {
+		if got := ValidateLocation(tt.loc); got != tt.want {
+			t.Errorf("ValidateLocation(%+v) = %v, want %v", tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestValidationErrorUnwrap(t *testing.T) {
+	route := straightRoute(6, 5, 1)
+	route[1] = Location{UTC: route[1].UTC}
+	route[4].Lng = math.NaN()
+
+	_, err := AdjustRoute(route, DefaultOptions())
+	var verr ValidationError
+	if !errors.As(err, &verr) || len(verr) != 2 {
+		t.Fatalf("AdjustRoute error %v is not a ValidationError of 2 locations", err)
+	}
+	for _, target := range []error{ErrNullIsland, ErrNotFinite} {
+		if !errors.Is(err, target) {
+			t.Errorf("errors.Is(%v, %v) = false", err, target)
+		}
+	}
+	if errors.Is(err, ErrLatitudeRange) {
+		t.Errorf("errors.Is(%v, %v) = true", err, ErrLatitudeRange)
+	}
+
+	var lerr *LocationError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("errors.As(%v, *LocationError) = false", err)
+	}
+	if lerr.Index != 1 || lerr.Err != ErrNullIsland {
+		t.Errorf("first LocationError is %v at index %d, want %v at index 1", lerr.Err, lerr.Index, ErrNullIsland)
+	}
+}
@@ -0,0 +1,114 @@
+package adjust
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ConfigWatcher keeps the configuration of a file up to date for a
+// long-running service, reloading it whenever the file changes. A
+// configuration that fails to load is reported and the previous one stays
+// in use.
+type ConfigWatcher struct {
+	path    string
+	onError func(error)
+
+	mu      sync.RWMutex
+	config  *Config
+	modTime time.Time
+	size    int64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WatchConfig loads the configuration in file path and checks the file for
+// changes every interval. onError, which may be nil, is called with every
+// failed reload.
+func WatchConfig(path string, interval time.Duration, onError func(error)) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		return nil, &OptionError{"interval", interval, "must be positive"}
+	}
+	w := &ConfigWatcher{
+		path:    path,
+		onError: onError,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	go w.watch(interval)
+	return w, nil
+}
+
+func (w *ConfigWatcher) watch(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if !w.changed() {
+				continue
+			}
+			if err := w.Reload(); err != nil && w.onError != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// changed tells whether the file differs from the one last loaded.
+func (w *ConfigWatcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		// let Reload report the error
+		return true
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// Reload loads the file now. The current configuration is only replaced
+// when the new one is valid.
+func (w *ConfigWatcher) Reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(w.path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// remember the failed file too, so it is not reloaded on every tick
+	w.modTime, w.size = info.ModTime(), info.Size()
+	if err != nil {
+		return err
+	}
+	w.config = config
+	return nil
+}
+
+// Config returns the configuration currently in use.
+func (w *ConfigWatcher) Config() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config
+}
+
+// Pipeline builds the pipeline for city from the configuration currently in use.
+func (w *ConfigWatcher) Pipeline(city string) (*Pipeline, error) {
+	return w.Config().Pipeline(city)
+}
+
+// Close stops watching the file. It may be called more than once.
+func (w *ConfigWatcher) Close() {
+	w.closeOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
@@ -0,0 +1,90 @@
+package adjust
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestConfigWatcherReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	writeConfig(t, path, `{"stages": [{"name": "filter", "params": {"max_speed": 10}}]}`)
+
+	errs := make(chan error, 10)
+	w, err := WatchConfig(path, 10*time.Millisecond, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	maxSpeed := func() interface{} {
+		return w.Config().Stages[0].Params["max_speed"]
+	}
+	if got := maxSpeed(); got != 10.0 {
+		t.Fatalf("max_speed %v, want 10", got)
+	}
+
+	writeConfig(t, path, `{"stages": [{"name": "filter", "params": {"max_speed": 25.5}}]}`)
+	if !waitFor(func() bool { return maxSpeed() == 25.5 }) {
+		t.Fatalf("max_speed %v after the change, want 25.5", maxSpeed())
+	}
+
+	// a bad configuration is reported and the previous one stays in use
+	writeConfig(t, path, `{"stages": [{"name": "filter", "params": {"max_speed": -1}}]}`)
+	select {
+	case err := <-errs:
+		if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("reload error %v is no *ConfigError", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("bad configuration not reported")
+	}
+	if got := maxSpeed(); got != 25.5 {
+		t.Errorf("max_speed %v after a bad change, want 25.5", got)
+	}
+	if _, err := w.Pipeline(""); err != nil {
+		t.Errorf("Pipeline: %v", err)
+	}
+}
+
+func TestConfigWatcherCloseTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	writeConfig(t, path, "stages:\n  - name: filter\n")
+	w, err := WatchConfig(path, time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	w.Close()
+}
+
+func TestConfigValidateDrop(t *testing.T) {
+	c, err := ParseConfig([]byte(`{"stages": [{"name": "validate", "params": {"drop": true}}]}`), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Pipeline("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := p.Stages[0].(ValidateStage); !ok || !s.Drop {
+		t.Errorf("stage %#v, want a ValidateStage that drops", p.Stages[0])
+	}
+}
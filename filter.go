@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// trackReport is one line of the report file of the filter command.
+type trackReport struct {
+	Track  string         `json:"track"`
+	Report *adjust.Report `json:"report"`
+}
+
+func runFilter(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("filter", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: filterroutes filter [flags]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Reads tracks as CSV or JSON Lines, removes implausible fixes and")
+		fmt.Fprintln(stderr, "writes the surviving records unchanged in the same format.")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	var (
+		in        = fs.String("in", "-", "input `file`, - for stdin")
+		out       = fs.String("out", "-", "output `file`, - for stdout")
+		format    = fs.String("format", "", "input and output format, csv or jsonl (default from the -in extension, else csv)")
+		columns   = fs.String("columns", "", "`mapping` of the fields "+strings.Join(mappableFields, ", ")+" to CSV columns by name or 0-based index, or to JSON keys, e.g. lat=latitude,lng=longitude,utc=time")
+		noHeader  = fs.Bool("no-header", false, "the CSV input has no header row")
+		report    = fs.String("report", "", "write a JSON Lines report of every track to `file`, - for stderr")
+		profile   = fs.String("profile", "", "transport-mode `profile`, one of "+strings.Join(adjust.ProfileNames(), ", "))
+		maxSpeed  = fs.Float64("max-speed", 0, "highest plausible speed in m/s")
+		factor    = fs.Float64("speed-factor", 0, "tolerance factor applied to -max-speed")
+		iter      = fs.Int("iterations", 0, "cap on the filter passes, 0 for no cap")
+		precision = fs.Int("precision", 0, "geohash length used by -cluster")
+		cluster   = fs.Bool("cluster", false, "share suspicion between fixes in the same geohash cell")
+		maxGap    = fs.Float64("max-gap", 0, "longest time in seconds between fixes still checked against the speed")
+		maxAcc    = fs.Float64("max-accuracy", 0, "drop fixes whose accuracy in metres is worse than this")
+		dropBad   = fs.Bool("drop-invalid", false, "drop invalid fixes instead of failing the track")
+	)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "filterroutes filter: unexpected argument %q\n", fs.Arg(0))
+		return exitUsage
+	}
+
+	opts := adjust.DefaultOptions()
+	if *profile != "" {
+		p, err := adjust.LookupProfile(*profile)
+		if err != nil {
+			fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+			return exitUsage
+		}
+		opts = p.Options()
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-speed":
+			opts.MaxSpeed = *maxSpeed
+		case "speed-factor":
+			opts.SpeedFactor = *factor
+		case "iterations":
+			opts.Iterations = *iter
+		case "precision":
+			opts.Precision = *precision
+		case "cluster":
+			opts.ClusterByGeohash = *cluster
+		case "max-gap":
+			opts.MaxGap = *maxGap
+		case "max-accuracy":
+			opts.MaxAccuracy = *maxAcc
+		case "drop-invalid":
+			opts.DropInvalid = *dropBad
+		}
+	})
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+		return exitUsage
+	}
+
+	if *format == "" {
+		*format = formatCSV
+		if ext := strings.ToLower(filepath.Ext(*in)); ext == ".jsonl" || ext == ".ndjson" {
+			*format = formatJSONL
+		}
+	}
+	if *format != formatCSV && *format != formatJSONL {
+		fmt.Fprintf(stderr, "filterroutes filter: unknown format %q, want csv or jsonl\n", *format)
+		return exitUsage
+	}
+	mapping, err := parseColumns(*columns)
+	if err != nil {
+		fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+		return exitUsage
+	}
+
+	input := stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+			return exitBadInput
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var header []string
+	var records []record
+	if *format == formatCSV {
+		header, records, err = readCSV(input, mapping, !*noHeader)
+	} else {
+		records, err = readJSONL(input, mapping)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "filterroutes filter: %s: %v\n", *in, err)
+		return exitBadInput
+	}
+
+	kept, reports, err := filterRecords(records, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "filterroutes filter: %s: %v\n", *in, err)
+		if _, ok := err.(*inputError); ok {
+			return exitBadInput
+		}
+		return exitInternal
+	}
+
+	if err := writeOutput(*out, stdout, func(w io.Writer) error {
+		if *format == formatCSV {
+			return writeCSV(w, header, kept)
+		}
+		return writeJSONL(w, kept)
+	}); err != nil {
+		fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+		return exitInternal
+	}
+	if *report != "" {
+		if err := writeOutput(*report, stderr, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			for _, r := range reports {
+				if err := encoder.Encode(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			fmt.Fprintf(stderr, "filterroutes filter: %v\n", err)
+			return exitInternal
+		}
+	}
+	return exitOK
+}
+
+// filterRecords filters every track of records and returns the surviving
+// records in input order along with the report of every track.
+func filterRecords(records []record, opts adjust.Options) ([]record, []trackReport, error) {
+	ids, tracks := groupTracks(records)
+	keep := make(map[int]bool)
+	var reports []trackReport
+	for _, id := range ids {
+		track := tracks[id]
+		fixes := make([]adjust.Fix, len(track))
+		for i, rec := range track {
+			fixes[i] = rec.fix
+		}
+		_, report, err := adjust.AdjustFixesWithReport(fixes, opts)
+		if err != nil {
+			if le, ok := invalidLocation(err); ok {
+				return nil, nil, &inputError{track[le.Index].line, le.Err}
+			}
+			return nil, nil, err
+		}
+		for _, p := range report.Points {
+			if p.Decision == adjust.DecisionKeep {
+				keep[track[p.Index].line] = true
+			}
+		}
+		reports = append(reports, trackReport{id, report})
+	}
+
+	var kept []record
+	for _, rec := range records {
+		if keep[rec.line] {
+			kept = append(kept, rec)
+		}
+	}
+	return kept, reports, nil
+}
+
+// invalidLocation returns the first invalid location err reports, if any.
+func invalidLocation(err error) (*adjust.LocationError, bool) {
+	var le *adjust.LocationError
+	if errors.As(err, &le) {
+		return le, true
+	}
+	return nil, false
+}
+
+// writeOutput runs write on the file at path, or on std when path is -.
+func writeOutput(path string, std io.Writer, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(std)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,314 @@
+// Package geojson reads and writes routes and filter reports as RFC 7946
+// GeoJSON. Positions are written longitude first, the opposite of the field
+// order of adjust.Location.
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// GeoJSON object types used by the package.
+const (
+	TypeFeatureCollection = "FeatureCollection"
+	TypeFeature           = "Feature"
+	TypePoint             = "Point"
+	TypeMultiPoint        = "MultiPoint"
+	TypeLineString        = "LineString"
+)
+
+// Properties written on the features of routes and removed points.
+const (
+	// PropertyTimes holds the UTC of every position of a route, in seconds.
+	PropertyTimes = "times"
+	// PropertyKind is KindRoute or KindRemoved.
+	PropertyKind = "kind"
+	// PropertyIndex is the position of a removed point in the input route.
+	PropertyIndex = "index"
+	// PropertyTime is the UTC of a removed point, in seconds.
+	PropertyTime = "time"
+	// PropertyReason is the rule that removed a point.
+	PropertyReason = "reason"
+	// PropertyIteration is the pass that removed a point.
+	PropertyIteration = "iteration"
+)
+
+// Kinds of the features made by the package.
+const (
+	KindRoute   = "route"
+	KindRemoved = "removed"
+)
+
+// Geometry is a GeoJSON geometry. Coordinates are kept undecoded since
+// their shape depends on Type.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Feature is a GeoJSON feature. Geometry is nil for a feature without one.
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         interface{}            `json:"id,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// FeatureCollection is a GeoJSON feature collection.
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// NewFeatureCollection returns a collection of features.
+func NewFeatureCollection(features ...*Feature) *FeatureCollection {
+	if features == nil {
+		features = []*Feature{}
+	}
+	return &FeatureCollection{Type: TypeFeatureCollection, Features: features}
+}
+
+// position returns the GeoJSON position of loc.
+func position(loc adjust.Location) []float64 {
+	return []float64{loc.Lng, loc.Lat}
+}
+
+// finite tells whether every value is a finite number, which JSON can
+// encode.
+func finite(values []float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func newGeometry(typ string, coordinates interface{}) (*Geometry, error) {
+	data, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+	return &Geometry{Type: typ, Coordinates: data}, nil
+}
+
+// RouteFeature returns route as a LineString feature, the UTC of every
+// point being in the times property. A route of fewer than two points,
+// which a LineString cannot hold, is a MultiPoint instead. It fails on a
+// point whose coordinates are not finite.
+func RouteFeature(route []adjust.Location) (*Feature, error) {
+	coordinates := make([][]float64, len(route))
+	times := make([]float64, len(route))
+	for i, loc := range route {
+		coordinates[i] = position(loc)
+		if !finite(coordinates[i]) || !finite([]float64{loc.UTC}) {
+			return nil, fmt.Errorf("geojson: point %d is not finite", i)
+		}
+		times[i] = loc.UTC
+	}
+	typ := TypeLineString
+	if len(route) < 2 {
+		typ = TypeMultiPoint
+	}
+	geometry, err := newGeometry(typ, coordinates)
+	if err != nil {
+		return nil, err
+	}
+	return &Feature{
+		Type:     TypeFeature,
+		Geometry: geometry,
+		Properties: map[string]interface{}{
+			PropertyKind:  KindRoute,
+			PropertyTimes: times,
+		},
+	}, nil
+}
+
+// RemovedFeatures returns a Point feature for every point of rawRoute that
+// report dropped, with the index, time, reason and iteration of the drop in
+// its properties. report must come from filtering rawRoute. An invalid point
+// whose coordinates are not finite has a null geometry, and a time that is
+// not finite is left out.
+func RemovedFeatures(rawRoute []adjust.Location, report *adjust.Report) []*Feature {
+	var features []*Feature
+	for _, p := range report.Points {
+		if p.Decision != adjust.DecisionDrop {
+			continue
+		}
+		loc := rawRoute[p.Index]
+		var geometry *Geometry
+		if pos := position(loc); finite(pos) {
+			geometry, _ = newGeometry(TypePoint, pos)
+		}
+		properties := map[string]interface{}{
+			PropertyKind:      KindRemoved,
+			PropertyIndex:     p.Index,
+			PropertyReason:    string(p.Rule),
+			PropertyIteration: p.Iteration,
+		}
+		if finite([]float64{loc.UTC}) {
+			properties[PropertyTime] = loc.UTC
+		}
+		features = append(features, &Feature{
+			Type:       TypeFeature,
+			Geometry:   geometry,
+			Properties: properties,
+		})
+	}
+	return features
+}
+
+// ReportCollection returns the outcome of filtering rawRoute as a collection
+// of the kept route followed by the removed points.
+func ReportCollection(rawRoute []adjust.Location, report *adjust.Report) (*FeatureCollection, error) {
+	var kept []adjust.Location
+	for _, p := range report.Points {
+		if p.Decision == adjust.DecisionKeep {
+			kept = append(kept, rawRoute[p.Index])
+		}
+	}
+	route, err := RouteFeature(kept)
+	if err != nil {
+		return nil, err
+	}
+	features := []*Feature{route}
+	return NewFeatureCollection(append(features, RemovedFeatures(rawRoute, report)...)...), nil
+}
+
+// RoutesCollection returns a collection of one feature per route.
+func RoutesCollection(routes [][]adjust.Location) (*FeatureCollection, error) {
+	features := make([]*Feature, len(routes))
+	for i, route := range routes {
+		var err error
+		if features[i], err = RouteFeature(route); err != nil {
+			return nil, fmt.Errorf("%v in route %d", err, i)
+		}
+	}
+	return NewFeatureCollection(features...), nil
+}
+
+// WriteRoutes writes routes as a feature collection. Nothing is written
+// when a route has a point whose coordinates are not finite.
+func WriteRoutes(w io.Writer, routes [][]adjust.Location) error {
+	collection, err := RoutesCollection(routes)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(collection)
+}
+
+// IsRoute tells whether f holds a route, that is a LineString or MultiPoint.
+func (f *Feature) IsRoute() bool {
+	return f.Geometry != nil && (f.Geometry.Type == TypeLineString || f.Geometry.Type == TypeMultiPoint)
+}
+
+// Route reads the route held by f. The UTC of the points comes from the
+// times property, and is zero when f has none. Altitudes are ignored.
+func (f *Feature) Route() ([]adjust.Location, error) {
+	if !f.IsRoute() {
+		return nil, fmt.Errorf("geojson: feature is not a LineString or MultiPoint")
+	}
+	var coordinates [][]float64
+	if err := json.Unmarshal(f.Geometry.Coordinates, &coordinates); err != nil {
+		return nil, fmt.Errorf("geojson: bad %s coordinates: %v", f.Geometry.Type, err)
+	}
+	times, err := f.times(len(coordinates))
+	if err != nil {
+		return nil, err
+	}
+	route := make([]adjust.Location, len(coordinates))
+	for i, p := range coordinates {
+		if len(p) < 2 {
+			return nil, fmt.Errorf("geojson: position %d has %d values, want at least 2", i, len(p))
+		}
+		route[i] = adjust.Location{Lng: p[0], Lat: p[1]}
+		if times != nil {
+			route[i].UTC = times[i]
+		}
+	}
+	return route, nil
+}
+
+// times reads the times property, which must hold n numbers if present.
+func (f *Feature) times(n int) ([]float64, error) {
+	value, ok := f.Properties[PropertyTimes]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	switch v := value.(type) {
+	case []float64:
+		if len(v) != n {
+			return nil, fmt.Errorf("geojson: %d times for %d positions", len(v), n)
+		}
+		return v, nil
+	case []interface{}:
+		if len(v) != n {
+			return nil, fmt.Errorf("geojson: %d times for %d positions", len(v), n)
+		}
+		times := make([]float64, n)
+		for i, t := range v {
+			utc, ok := t.(float64)
+			if !ok {
+				return nil, fmt.Errorf("geojson: time %d is not a number", i)
+			}
+			times[i] = utc
+		}
+		return times, nil
+	}
+	return nil, fmt.Errorf("geojson: times property is not an array")
+}
+
+// ReadRoutes reads the routes of a FeatureCollection, a Feature or a bare
+// LineString or MultiPoint geometry. Features of other geometries, such as
+// the removed points of ReportCollection, are skipped.
+func ReadRoutes(r io.Reader) ([][]adjust.Location, error) {
+	var data json.RawMessage
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+
+	var features []*Feature
+	var err error
+	switch head.Type {
+	case TypeFeatureCollection:
+		var collection FeatureCollection
+		err = json.Unmarshal(data, &collection)
+		features = collection.Features
+	case TypeFeature:
+		feature := new(Feature)
+		err = json.Unmarshal(data, feature)
+		features = []*Feature{feature}
+	case TypeLineString, TypeMultiPoint:
+		geometry := new(Geometry)
+		err = json.Unmarshal(data, geometry)
+		features = []*Feature{{Type: TypeFeature, Geometry: geometry}}
+	default:
+		return nil, fmt.Errorf("geojson: cannot read routes from a %q object", head.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("geojson: %v", err)
+	}
+
+	var routes [][]adjust.Location
+	for i, f := range features {
+		if f == nil || !f.IsRoute() {
+			continue
+		}
+		route, err := f.Route()
+		if err != nil {
+			return nil, fmt.Errorf("%v in feature %d", err, i)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
@@ -0,0 +1,220 @@
+package geojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// straightRoute returns n fixes heading north at 5 m/s, one a second.
+func straightRoute(n int) []adjust.Location {
+	route := make([]adjust.Location, n)
+	for i := range route {
+		route[i] = adjust.Location{Lat: 31.2 + float64(i)*5/111195, Lng: 121.4, UTC: 1.5e9 + float64(i)}
+	}
+	return route
+}
+
+func TestLongitudeFirst(t *testing.T) {
+	routes := [][]adjust.Location{{{Lat: 31.2, Lng: 121.4, UTC: 1}, {Lat: 31.3, Lng: 121.5, UTC: 2}}}
+	var buf bytes.Buffer
+	if err := WriteRoutes(&buf, routes); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates [][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{121.4, 31.2}, {121.5, 31.3}}
+	if got := collection.Features[0].Geometry.Coordinates; !reflect.DeepEqual(got, want) {
+		t.Errorf("coordinates %v, want %v", got, want)
+	}
+
+	got, err := ReadRoutes(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, routes) {
+		t.Errorf("read back %v, want %v", got, routes)
+	}
+}
+
+func TestRoutesRoundTrip(t *testing.T) {
+	routes := [][]adjust.Location{
+		straightRoute(3),
+		{},
+		{{Lat: 39.9, Lng: 116.4, UTC: 1600000020}},
+		{{Lat: -33.9, Lng: 151.2, UTC: 1}, {Lat: -33.8, Lng: 151.3, UTC: 2}},
+	}
+	collection, err := RoutesCollection(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{TypeLineString, TypeMultiPoint, TypeMultiPoint, TypeLineString}
+	for i, f := range collection.Features {
+		if f.Geometry.Type != types[i] {
+			t.Errorf("route %d written as %s, want %s", i, f.Geometry.Type, types[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteRoutes(&buf, routes); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+	got, err := ReadRoutes(&buf)
+	if err != nil {
+		t.Fatalf("%v reading\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got, routes) {
+		t.Errorf("read back %v, want %v from\n%s", got, routes, data)
+	}
+}
+
+func TestWriteRoutesNotFinite(t *testing.T) {
+	for _, bad := range []func(*adjust.Location){
+		func(loc *adjust.Location) { loc.Lat = math.NaN() },
+		func(loc *adjust.Location) { loc.Lng = math.Inf(1) },
+		func(loc *adjust.Location) { loc.UTC = math.NaN() },
+	} {
+		route := straightRoute(3)
+		bad(&route[1])
+		var buf bytes.Buffer
+		if err := WriteRoutes(&buf, [][]adjust.Location{straightRoute(2), route}); err == nil {
+			t.Errorf("no error writing %v", route)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("wrote %s", buf.String())
+		}
+	}
+}
+
+func TestReadTimes(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []adjust.Location
+		err  bool
+	}{
+		{
+			name: "bare geometry with an altitude",
+			data: `{"type": "LineString", "coordinates": [[121.4, 31.2], [121.5, 31.3, 7]]}`,
+			want: []adjust.Location{{Lat: 31.2, Lng: 121.4}, {Lat: 31.3, Lng: 121.5}},
+		},
+		{
+			name: "feature",
+			data: `{"type": "Feature", "geometry": {"type": "MultiPoint", "coordinates": [[121.4, 31.2]]}, "properties": {"times": [5]}}`,
+			want: []adjust.Location{{Lat: 31.2, Lng: 121.4, UTC: 5}},
+		},
+		{
+			name: "too few times",
+			data: `{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[121.4, 31.2], [121.5, 31.3]]}, "properties": {"times": [5]}}`,
+			err:  true,
+		},
+		{
+			name: "too many times",
+			data: `{"type": "Feature", "geometry": {"type": "MultiPoint", "coordinates": [[121.4, 31.2]]}, "properties": {"times": [5, 6]}}`,
+			err:  true,
+		},
+		{
+			name: "time not a number",
+			data: `{"type": "Feature", "geometry": {"type": "MultiPoint", "coordinates": [[121.4, 31.2]]}, "properties": {"times": ["5"]}}`,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		routes, err := ReadRoutes(strings.NewReader(tt.data))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(routes) != 1 || !reflect.DeepEqual(routes[0], tt.want) {
+			t.Errorf("%s: read %v, want %v", tt.name, routes, tt.want)
+		}
+	}
+}
+
+func TestReportCollection(t *testing.T) {
+	raw := straightRoute(12)
+	raw[6].Lng += 0.01
+	raw[9].Lat = math.NaN()
+	opts := adjust.DefaultOptions()
+	opts.DropInvalid = true
+	_, report, err := adjust.AdjustRouteWithReport(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := ReportCollection(raw, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(collection.Features); n != 3 {
+		t.Fatalf("%d features, want the route and 2 removed points", n)
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ReadRoutes(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || len(routes[0]) != 10 {
+		t.Fatalf("read routes %v, want the 10 kept points", routes)
+	}
+
+	var decoded FeatureCollection
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	removed := decoded.Features[1:]
+	tests := []struct {
+		index     float64
+		reason    adjust.Rule
+		iteration float64
+		geometry  bool
+	}{
+		{6, adjust.RuleSpeed, 1, true},
+		{9, adjust.RuleInvalid, 0, false},
+	}
+	for i, tt := range tests {
+		f := removed[i]
+		want := map[string]interface{}{
+			PropertyKind:      KindRemoved,
+			PropertyIndex:     tt.index,
+			PropertyTime:      raw[int(tt.index)].UTC,
+			PropertyReason:    string(tt.reason),
+			PropertyIteration: tt.iteration,
+		}
+		if !reflect.DeepEqual(f.Properties, want) {
+			t.Errorf("removed point %d: properties %v, want %v", i, f.Properties, want)
+		}
+		if (f.Geometry != nil) != tt.geometry {
+			t.Errorf("removed point %d: geometry %v", i, f.Geometry)
+		}
+	}
+	var point []float64
+	if g := removed[0].Geometry; g.Type != TypePoint || json.Unmarshal(g.Coordinates, &point) != nil ||
+		!reflect.DeepEqual(point, []float64{raw[6].Lng, raw[6].Lat}) {
+		t.Errorf("removed point geometry %s %s, want a Point at %v", g.Type, g.Coordinates, raw[6])
+	}
+}
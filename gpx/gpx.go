@@ -0,0 +1,226 @@
+// Package gpx reads and writes tracks in the GPX 1.1 format.
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// Namespace is the XML namespace of GPX 1.1.
+const Namespace = "http://www.topografix.com/GPX/1/1"
+
+// Creator is written in the creator attribute of every document.
+const Creator = "FilterRoutes"
+
+// Track is a GPX track. Every segment is a route of its own, the points of
+// a segment being in the order of the file.
+type Track struct {
+	Name     string
+	Segments [][]adjust.Fix
+}
+
+type document struct {
+	XMLName xml.Name `xml:"gpx"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Tracks  []track  `xml:"trk"`
+}
+
+type track struct {
+	Name     string    `xml:"name,omitempty"`
+	Segments []segment `xml:"trkseg"`
+}
+
+type segment struct {
+	Points []point `xml:"trkpt"`
+}
+
+// point holds the text of a trkpt, in the element order of the schema.
+// Numbers are kept as text since encoding/xml may write them in exponent
+// notation, which xsd:decimal does not allow.
+type point struct {
+	Lat  string `xml:"lat,attr"`
+	Lon  string `xml:"lon,attr"`
+	Ele  string `xml:"ele,omitempty"`
+	Time string `xml:"time,omitempty"`
+	Sat  string `xml:"sat,omitempty"`
+	HDOP string `xml:"hdop,omitempty"`
+}
+
+// Read reads the tracks of a GPX document. The namespace is not checked,
+// so GPX 1.0 documents are read as well. Points take their lat, lon, ele,
+// time, sat and hdop, every other element being ignored; a point without
+// a time gets a zero UTC.
+func Read(r io.Reader) ([]Track, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("gpx: %v", err)
+	}
+	tracks := make([]Track, len(doc.Tracks))
+	for t, trk := range doc.Tracks {
+		tracks[t].Name = strings.TrimSpace(trk.Name)
+		tracks[t].Segments = make([][]adjust.Fix, len(trk.Segments))
+		for s, seg := range trk.Segments {
+			route := make([]adjust.Fix, len(seg.Points))
+			for i, pt := range seg.Points {
+				fix, err := pt.fix()
+				if err != nil {
+					return nil, fmt.Errorf("gpx: track %d segment %d point %d: %v", t, s, i, err)
+				}
+				route[i] = fix
+			}
+			tracks[t].Segments[s] = route
+		}
+	}
+	return tracks, nil
+}
+
+// ReadRoutes reads a GPX document as one route per track segment. Only the
+// position and time of the points are kept, Read has the rest.
+func ReadRoutes(r io.Reader) ([][]adjust.Location, error) {
+	tracks, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	var routes [][]adjust.Location
+	for _, trk := range tracks {
+		for _, seg := range trk.Segments {
+			routes = append(routes, adjust.Locations(seg))
+		}
+	}
+	return routes, nil
+}
+
+// Write writes tracks as a GPX 1.1 document. Elevation, time, satellites
+// and HDOP are only written when known, that is non-zero.
+func Write(w io.Writer, tracks []Track) error {
+	doc := document{
+		Xmlns:   Namespace,
+		Version: "1.1",
+		Creator: Creator,
+		Tracks:  make([]track, len(tracks)),
+	}
+	for t, trk := range tracks {
+		doc.Tracks[t].Name = trk.Name
+		doc.Tracks[t].Segments = make([]segment, len(trk.Segments))
+		for s, route := range trk.Segments {
+			points := make([]point, len(route))
+			for i, fix := range route {
+				points[i] = newPoint(fix)
+			}
+			doc.Tracks[t].Segments[s].Points = points
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteRoutes writes every route as a track of a single segment.
+func WriteRoutes(w io.Writer, routes [][]adjust.Location) error {
+	tracks := make([]Track, len(routes))
+	for i, route := range routes {
+		tracks[i].Segments = [][]adjust.Fix{adjust.Fixes(route)}
+	}
+	return Write(w, tracks)
+}
+
+func (p point) fix() (adjust.Fix, error) {
+	var fix adjust.Fix
+	var err error
+	if fix.Lat, err = parseFloat("lat", p.Lat); err != nil {
+		return fix, err
+	}
+	if fix.Lng, err = parseFloat("lon", p.Lon); err != nil {
+		return fix, err
+	}
+	if p.Ele != "" {
+		if fix.Elevation, err = parseFloat("ele", p.Ele); err != nil {
+			return fix, err
+		}
+	}
+	if p.Time != "" {
+		if fix.UTC, err = parseTime(p.Time); err != nil {
+			return fix, err
+		}
+	}
+	if p.Sat != "" {
+		if fix.Satellites, err = strconv.Atoi(strings.TrimSpace(p.Sat)); err != nil {
+			return fix, fmt.Errorf("bad sat %q", p.Sat)
+		}
+	}
+	if p.HDOP != "" {
+		if fix.HDOP, err = parseFloat("hdop", p.HDOP); err != nil {
+			return fix, err
+		}
+	}
+	return fix, nil
+}
+
+func newPoint(fix adjust.Fix) point {
+	p := point{Lat: formatFloat(fix.Lat), Lon: formatFloat(fix.Lng)}
+	if fix.Elevation != 0 {
+		p.Ele = formatFloat(fix.Elevation)
+	}
+	if fix.UTC != 0 {
+		p.Time = formatTime(fix.UTC)
+	}
+	if fix.Satellites != 0 {
+		p.Sat = strconv.Itoa(fix.Satellites)
+	}
+	if fix.HDOP != 0 {
+		p.HDOP = formatFloat(fix.HDOP)
+	}
+	return p
+}
+
+func parseFloat(name, text string) (float64, error) {
+	val, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s %q", name, text)
+	}
+	return val, nil
+}
+
+func formatFloat(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// layout of an xsd:dateTime without a time zone, which is taken as UTC
+const localLayout = "2006-01-02T15:04:05.999999999"
+
+func parseTime(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	t, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		if t, err = time.Parse(localLayout, text); err != nil {
+			return 0, fmt.Errorf("bad time %q", text)
+		}
+	}
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9, nil
+}
+
+// formatTime writes utc to the millisecond, the precision of GPS receivers,
+// so that a round trip does not pick up float noise.
+func formatTime(utc float64) string {
+	ms := int64(utc*1000 + 0.5)
+	if utc < 0 {
+		ms = int64(utc*1000 - 0.5)
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.999Z07:00")
+}
@@ -0,0 +1,165 @@
+package gpx
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// fix returns a fix without metadata.
+func fix(lat, lng, utc float64) adjust.Fix {
+	return adjust.Fix{Location: adjust.Location{Lat: lat, Lng: lng, UTC: utc}}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tracks := []Track{
+		{
+			Name: "morning ride",
+			Segments: [][]adjust.Fix{
+				{
+					{Location: adjust.Location{Lat: 31.2, Lng: 121.4, UTC: 1600000000.123}, Elevation: 12.5, HDOP: 1.2, Satellites: 7},
+					{Location: adjust.Location{Lat: 31.20005, Lng: 121.40001, UTC: 1600000001}, Elevation: -3, HDOP: 0.9, Satellites: 11},
+				},
+				// after a tunnel
+				{
+					fix(0.00001, -0.5, 1600000300.5),
+				},
+			},
+		},
+		{
+			Segments: [][]adjust.Fix{
+				{fix(-33.9, 151.2, 1)},
+				{},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, tracks); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("%v reading\n%s", err, data)
+	}
+	if !reflect.DeepEqual(got, tracks) {
+		t.Errorf("read back %+v, want %+v from\n%s", got, tracks, data)
+	}
+	// xsd:decimal has no exponents
+	if strings.Contains(data, "e-") {
+		t.Errorf("exponent in\n%s", data)
+	}
+}
+
+func TestRoutesRoundTrip(t *testing.T) {
+	routes := [][]adjust.Location{
+		{{Lat: 31.2, Lng: 121.4, UTC: 1600000000}, {Lat: 31.3, Lng: 121.5, UTC: 1600000010}},
+		{{Lat: 39.9, Lng: 116.4, UTC: 1600000020}},
+	}
+	var buf bytes.Buffer
+	if err := WriteRoutes(&buf, routes); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRoutes(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, routes) {
+		t.Errorf("read back %+v, want %+v", got, routes)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want [][]adjust.Fix
+	}{
+		{
+			name: "every track and segment is a route",
+			doc: `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="handheld" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata><name>test ride</name></metadata>
+  <wpt lat="1" lon="2"><name>ignored</name></wpt>
+  <trk>
+    <name>first</name>
+    <trkseg>
+      <trkpt lat="31.2" lon="121.4"><ele>4.2</ele><time>2020-01-01T08:00:00+08:00</time><sat>9</sat><hdop>0.8</hdop></trkpt>
+      <trkpt lat="31.3" lon="121.5"><time>2020-01-01T00:00:01.5Z</time><extensions><speed>3</speed></extensions></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="31.4" lon="121.6"/>
+    </trkseg>
+  </trk>
+  <trk>
+    <trkseg>
+      <trkpt lat=" -33.9 " lon="151.2"><time>2020-01-01T00:00:02Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`,
+			want: [][]adjust.Fix{
+				{
+					{Location: adjust.Location{Lat: 31.2, Lng: 121.4, UTC: 1577836800}, Elevation: 4.2, Satellites: 9, HDOP: 0.8},
+					fix(31.3, 121.5, 1577836801.5),
+				},
+				{fix(31.4, 121.6, 0)},
+				{fix(-33.9, 151.2, 1577836802)},
+			},
+		},
+		{
+			name: "no namespace and no time zone",
+			doc: `<gpx version="1.0">
+  <trk><trkseg>
+    <trkpt lat="1.5" lon="2"><time>2020-01-01T00:00:00</time></trkpt>
+    <trkpt lat="1.6" lon="2"><time>2020-01-01T00:00:01.25</time></trkpt>
+  </trkseg></trk>
+</gpx>`,
+			want: [][]adjust.Fix{
+				{fix(1.5, 2, 1577836800), fix(1.6, 2, 1577836801.25)},
+			},
+		},
+		{
+			name: "GPX 1.0 namespace",
+			doc: `<gpx version="1.0" xmlns="http://www.topografix.com/GPX/1/0">
+  <trk><trkseg><trkpt lat="1.5" lon="2"><ele>100</ele></trkpt></trkseg></trk>
+</gpx>`,
+			want: [][]adjust.Fix{
+				{{Location: adjust.Location{Lat: 1.5, Lng: 2}, Elevation: 100}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tracks, err := Read(strings.NewReader(tt.doc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var got [][]adjust.Fix
+		for _, trk := range tracks {
+			got = append(got, trk.Segments...)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: read %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not XML", `{"type": "FeatureCollection"}`},
+		{"bad lat", `<gpx><trk><trkseg><trkpt lat="north" lon="2"/></trkseg></trk></gpx>`},
+		{"bad time", `<gpx><trk><trkseg><trkpt lat="1" lon="2"><time>yesterday</time></trkpt></trkseg></trk></gpx>`},
+		{"bad sat", `<gpx><trk><trkseg><trkpt lat="1" lon="2"><sat>many</sat></trkpt></trkseg></trk></gpx>`},
+	}
+	for _, tt := range tests {
+		if _, err := Read(strings.NewReader(tt.doc)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -2,24 +2,59 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+)
 
-	"github.com/Wan-Mi/FilterRoutes/adjust"
+// Exit codes of the filterroutes command.
+const (
+	exitOK       = 0
+	exitInternal = 1
+	exitUsage    = 2
+	exitBadInput = 3
 )
 
-func main() {
+type command struct {
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
 
-	oriLocations := []adjust.Location{}
-	loc := adjust.Location{
-		22.1,
-		112.2,
-		1513590840,
-	}
+var commands = map[string]command{
+	"filter": {"remove implausible fixes from GPS tracks", runFilter},
+}
 
-	oriLocations = append(oriLocations, loc)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: filterroutes <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, name := range []string{"filter"} {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'filterroutes <command> -h' for the flags of a command.")
+	fmt.Fprintf(w, "Exit codes: %d ok, %d internal error, %d bad usage, %d bad input.\n",
+		exitOK, exitInternal, exitUsage, exitBadInput)
+}
 
-	if resRouts, err := adjust.AdjustedRoute(oriLocations); err != nil {
-		fmt.Println("err:", err)
-	} else {
-		fmt.Println(resRouts)
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "filterroutes: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
 	}
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
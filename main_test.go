@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// track has a fix 1 km off between two fixes a second apart on either side
+const track = `id,latitude,longitude,time
+a,31.2,121.4,0
+a,31.20005,121.4,1
+a,31.2001,121.41,2
+a,31.20015,121.4,3
+a,31.2002,121.4,4
+`
+
+func runCommand(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no command", nil, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"unknown command", []string{"smooth"}, exitUsage},
+		{"unknown flag", []string{"filter", "-speed", "3"}, exitUsage},
+		{"extra argument", []string{"filter", "track.csv"}, exitUsage},
+		{"bad option", []string{"filter", "-max-speed", "-1"}, exitUsage},
+		{"unknown profile", []string{"filter", "-profile", "rocket"}, exitUsage},
+		{"unknown format", []string{"filter", "-format", "xml"}, exitUsage},
+		{"bad mapping", []string{"filter", "-columns", "altitude=ele"}, exitUsage},
+	}
+	for _, tt := range tests {
+		if code, _, stderr := runCommand(t, "", tt.args...); code != tt.want {
+			t.Errorf("%s: exit code %d, want %d; stderr: %s", tt.name, code, tt.want, stderr)
+		}
+	}
+}
+
+func TestFilterBadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+	}{
+		{"missing file", "", []string{"-in", filepath.Join(t.TempDir(), "missing.csv")}},
+		{"missing column", "lat,lng\n31.2,121.4\n", nil},
+		{"bad number", "lat,lng,utc\n31.2,east,0\n", nil},
+		{"bad json", `{"lat": 31.2,` + "\n", []string{"-format", "jsonl"}},
+		{"invalid location", "lat,lng,utc\n31.2,121.4,0\n121.4,31.2,1\n", nil},
+	}
+	for _, tt := range tests {
+		if code, _, stderr := runCommand(t, tt.input, append([]string{"filter"}, tt.args...)...); code != exitBadInput {
+			t.Errorf("%s: exit code %d, want %d; stderr: %s", tt.name, code, exitBadInput, stderr)
+		}
+	}
+
+	_, _, stderr := runCommand(t, "lat,lng,utc\n31.2,121.4,0\n121.4,31.2,1\n", "filter")
+	if !strings.Contains(stderr, "line 3:") {
+		t.Errorf("invalid location reported as %q, want line 3", stderr)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFilterInternalError(t *testing.T) {
+	csv := "lat,lng,utc\n31.2,121.4,0\n"
+	if code := run([]string{"filter"}, strings.NewReader(csv), failingWriter{}, ioutil.Discard); code != exitInternal {
+		t.Errorf("failing stdout: exit code %d, want %d", code, exitInternal)
+	}
+	out := filepath.Join(t.TempDir(), "missing", "out.csv")
+	if code, _, stderr := runCommand(t, csv, "filter", "-out", out); code != exitInternal {
+		t.Errorf("unwritable -out: exit code %d, want %d; stderr: %s", code, exitInternal, stderr)
+	}
+}
+
+func TestFilterColumnMapping(t *testing.T) {
+	code, stdout, stderr := runCommand(t, track, "filter", "-columns", "lat=latitude,lng=longitude,utc=time,track=id", "-report", "-")
+	if code != exitOK {
+		t.Fatalf("exit code %d; stderr: %s", code, stderr)
+	}
+	lines := strings.Split(track, "\n")
+	want := strings.Join(append(lines[:3:3], lines[4:]...), "\n")
+	if stdout != want {
+		t.Errorf("output\n%s\nwant\n%s", stdout, want)
+	}
+	var report trackReport
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil {
+		t.Fatalf("report %q: %v", stderr, err)
+	}
+	if report.Track != "a" || len(report.Report.Points) != 5 {
+		t.Errorf("report of track %q with %d points, want track a with 5", report.Track, len(report.Report.Points))
+	}
+
+	// the same columns by index, without a header
+	noHeader := strings.Join(lines[1:], "\n")
+	code, stdout, stderr = runCommand(t, noHeader, "filter", "-no-header", "-columns", "lat=1,lng=2,utc=3,track=0")
+	if code != exitOK {
+		t.Fatalf("by index: exit code %d; stderr: %s", code, stderr)
+	}
+	if want := strings.Join(append(lines[1:3:3], lines[4:]...), "\n"); stdout != want {
+		t.Errorf("by index: output\n%s\nwant\n%s", stdout, want)
+	}
+}
+
+func TestFilterJSONLines(t *testing.T) {
+	input := `{"la": 31.2, "lo": 121.4, "t": "2020-01-01T00:00:00Z", "rider": 1}
+{"la": 31.20005, "lo": 121.4, "t": "2020-01-01T00:00:01Z", "rider": 1}
+{"la": 31.2001, "lo": 121.41, "t": "2020-01-01T00:00:02Z", "rider": 1}
+
+{"la": 31.20015, "lo": 121.4, "t": "2020-01-01T00:00:03Z", "rider": 1}
+{"la": 31.2002, "lo": 121.4, "t": "2020-01-01T00:00:04Z", "rider": 1}
+`
+	code, stdout, stderr := runCommand(t, input, "filter", "-format", "jsonl", "-columns", "lat=la,lng=lo,utc=t")
+	if code != exitOK {
+		t.Fatalf("exit code %d; stderr: %s", code, stderr)
+	}
+	lines := strings.Split(input, "\n")
+	want := strings.Join([]string{lines[0], lines[1], lines[4], lines[5], ""}, "\n")
+	if stdout != want {
+		t.Errorf("output\n%s\nwant\n%s", stdout, want)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wan-Mi/FilterRoutes/adjust"
+)
+
+// Input and output formats of the filter command.
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// fields that a column mapping can name
+var mappableFields = []string{"lat", "lng", "utc", "accuracy", "hdop", "satellites", "provider", "track"}
+
+// columnMapping maps a field to the CSV column, by header name or 0-based
+// index, or to the JSON key that holds it.
+type columnMapping map[string]string
+
+// parseColumns reads a mapping such as "lat=latitude,lng=longitude,utc=time"
+// over the default mapping of every field to the column of the same name.
+func parseColumns(spec string) (columnMapping, error) {
+	m := columnMapping{"lat": "lat", "lng": "lng", "utc": "utc"}
+	if spec == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("bad column mapping %q, want field=column", pair)
+		}
+		field := strings.TrimSpace(kv[0])
+		known := false
+		for _, f := range mappableFields {
+			known = known || f == field
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q in column mapping, want one of %s", field, strings.Join(mappableFields, ", "))
+		}
+		m[field] = strings.TrimSpace(kv[1])
+	}
+	return m, nil
+}
+
+// record is one fix of the input along with the raw data it was read from,
+// which is written back unchanged when the fix survives.
+type record struct {
+	fix   adjust.Fix
+	track string
+	line  int
+	row   []string
+	raw   []byte
+}
+
+// inputError reports input that cannot be read as tracks.
+type inputError struct {
+	line int
+	err  error
+}
+
+func (e *inputError) Error() string {
+	if e.line == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+// setField parses value into the field of rec that field names.
+func setField(rec *record, field, value string) error {
+	var err error
+	switch field {
+	case "lat":
+		rec.fix.Lat, err = strconv.ParseFloat(value, 64)
+	case "lng":
+		rec.fix.Lng, err = strconv.ParseFloat(value, 64)
+	case "utc":
+		rec.fix.UTC, err = parseTime(value)
+	case "accuracy":
+		rec.fix.Accuracy, err = strconv.ParseFloat(value, 64)
+	case "hdop":
+		rec.fix.HDOP, err = strconv.ParseFloat(value, 64)
+	case "satellites":
+		rec.fix.Satellites, err = strconv.Atoi(value)
+	case "provider":
+		rec.fix.Provider = adjust.Provider(value)
+	case "track":
+		rec.track = value
+	}
+	if err != nil {
+		return fmt.Errorf("bad %s %q", field, value)
+	}
+	return nil
+}
+
+// parseTime reads seconds since the Unix epoch or an RFC 3339 time.
+func parseTime(value string) (float64, error) {
+	if utc, err := strconv.ParseFloat(value, 64); err == nil {
+		return utc, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, err
+	}
+	return float64(t.UnixNano()) / 1e9, nil
+}
+
+// readCSV reads the records of a CSV file. With a header, columns can be
+// mapped by name, otherwise only by index.
+func readCSV(r io.Reader, m columnMapping, header bool) ([]string, []record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var names []string
+	line := 0
+	if header {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, &inputError{1, err}
+		}
+		names = row
+		line++
+	}
+
+	columns := make(map[string]int)
+	for field, column := range m {
+		if index, err := strconv.Atoi(column); err == nil && index >= 0 {
+			columns[field] = index
+			continue
+		}
+		found := false
+		for i, name := range names {
+			if strings.TrimSpace(name) == column {
+				columns[field], found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, &inputError{0, fmt.Errorf("no column %q for field %s", column, field)}
+		}
+	}
+
+	var records []record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, nil, &inputError{line, err}
+		}
+		rec := record{line: line, row: row}
+		for field, index := range columns {
+			if index >= len(row) {
+				return nil, nil, &inputError{line, fmt.Errorf("missing column %d for field %s", index, field)}
+			}
+			if err := setField(&rec, field, strings.TrimSpace(row[index])); err != nil {
+				return nil, nil, &inputError{line, err}
+			}
+		}
+		records = append(records, rec)
+	}
+	return names, records, nil
+}
+
+// readJSONL reads one JSON object per line, blank lines being skipped.
+func readJSONL(r io.Reader, m columnMapping) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var records []record
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, &inputError{line, err}
+		}
+
+		rec := record{line: line, raw: append([]byte{}, raw...)}
+		for field, key := range m {
+			value, ok := object[key]
+			if !ok {
+				if field == "lat" || field == "lng" || field == "utc" {
+					return nil, &inputError{line, fmt.Errorf("missing key %q for field %s", key, field)}
+				}
+				continue
+			}
+			var text string
+			switch v := value.(type) {
+			case json.Number:
+				text = v.String()
+			case string:
+				text = v
+			default:
+				return nil, &inputError{line, fmt.Errorf("key %q holds neither a number nor a string", key)}
+			}
+			if err := setField(&rec, field, text); err != nil {
+				return nil, &inputError{line, err}
+			}
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &inputError{line + 1, err}
+	}
+	return records, nil
+}
+
+// writeCSV writes the header, if any, and the rows of records.
+func writeCSV(w io.Writer, header []string, records []record) error {
+	writer := csv.NewWriter(w)
+	if header != nil {
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		if err := writer.Write(rec.row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSONL writes the lines of records.
+func writeJSONL(w io.Writer, records []record) error {
+	for _, rec := range records {
+		if _, err := w.Write(append(rec.raw, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupTracks splits records by track, in order of first appearance.
+func groupTracks(records []record) (ids []string, tracks map[string][]record) {
+	tracks = make(map[string][]record)
+	for _, rec := range records {
+		if _, ok := tracks[rec.track]; !ok {
+			ids = append(ids, rec.track)
+		}
+		tracks[rec.track] = append(tracks[rec.track], rec)
+	}
+	return ids, tracks
+}